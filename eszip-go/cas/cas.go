@@ -0,0 +1,237 @@
+// Copyright 2018-2024 the Deno authors. All rights reserved. MIT license.
+
+// Package cas implements a directory-backed content-addressable store for
+// eszip module sources, so that multiple eszip archives sharing the same
+// transpiled output share the same bytes on disk instead of each carrying
+// its own copy.
+package cas
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	eszip "github.com/example/eszip-go"
+)
+
+// storeEntry is the value a Store's radix tree maps each specifier to.
+type storeEntry struct {
+	digest [32]byte
+	kind   eszip.ModuleKind
+}
+
+// Store is a directory of content-addressed blobs (named by the SHA-256 of
+// their content, under a "sha256" subdirectory; a source map is stored
+// under its source's digest plus ".map") plus an in-memory radix
+// tree mapping specifiers to the digests that identify their current
+// content.
+type Store struct {
+	root string
+
+	mu   sync.RWMutex
+	tree *radixNode
+}
+
+// Open returns a Store rooted at dir, creating the directory if it doesn't
+// already exist.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("cas: creating store root: %w", err)
+	}
+	return &Store{root: dir}, nil
+}
+
+// Put walks archive's specifiers, writing each module's source (and source
+// map, if present) into the store under its content digest, and records a
+// specifier -> digest mapping in the tree. Two archives that share content
+// end up pointing at the same on-disk blob.
+func (s *Store) Put(ctx context.Context, archive *eszip.EszipUnion) error {
+	for _, specifier := range archive.Specifiers() {
+		module := archive.GetModule(specifier)
+		if module == nil {
+			continue
+		}
+
+		source, err := module.Source(ctx)
+		if err != nil {
+			return fmt.Errorf("cas: reading source for %s: %w", specifier, err)
+		}
+		if source == nil {
+			continue
+		}
+
+		digest := sha256.Sum256(source)
+		if err := s.writeBlob(digest[:], "", source); err != nil {
+			return err
+		}
+
+		if sourceMap, err := module.SourceMap(ctx); err == nil && len(sourceMap) > 0 {
+			if err := s.writeBlob(digest[:], ".map", sourceMap); err != nil {
+				return err
+			}
+		}
+
+		s.mu.Lock()
+		s.tree = s.tree.insert(specifier, &storeEntry{digest: digest, kind: module.Kind})
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// Materialize returns the stored source bytes for specifier.
+func (s *Store) Materialize(specifier string) ([]byte, error) {
+	entry, ok := s.lookup(specifier)
+	if !ok {
+		return nil, fmt.Errorf("cas: no stored digest for %s", specifier)
+	}
+	return os.ReadFile(s.blobPath(entry.digest[:], ""))
+}
+
+// BuildEszip reconstructs a V2 archive containing the given specifiers
+// from the store.
+func (s *Store) BuildEszip(specifiers []string) (*eszip.EszipV2, error) {
+	out := eszip.NewV2()
+	for _, specifier := range specifiers {
+		entry, ok := s.lookup(specifier)
+		if !ok {
+			return nil, fmt.Errorf("cas: no stored digest for %s", specifier)
+		}
+
+		source, err := os.ReadFile(s.blobPath(entry.digest[:], ""))
+		if err != nil {
+			return nil, fmt.Errorf("cas: reading source for %s: %w", specifier, err)
+		}
+
+		var sourceMap []byte
+		if mapPath := s.blobPath(entry.digest[:], ".map"); fileExists(mapPath) {
+			sourceMap, err = os.ReadFile(mapPath)
+			if err != nil {
+				return nil, fmt.Errorf("cas: reading source map for %s: %w", specifier, err)
+			}
+		}
+
+		out.AddModule(specifier, entry.kind, source, sourceMap)
+	}
+	return out, nil
+}
+
+// LinkOrStore hardlinks destPath to the stored blob for content's digest,
+// storing the blob first if this is the first time this exact content has
+// been seen. It's the read-through half of content addressing used by
+// 'eszip extract --cas': whichever archive extracts this content first
+// pays the cost of writing it, and every later extraction of the same
+// bytes -- from this archive or any other -- reuses them via a hardlink.
+func (s *Store) LinkOrStore(content []byte, destPath string) error {
+	digest := sha256.Sum256(content)
+	path := s.blobPath(digest[:], "")
+
+	if !fileExists(path) {
+		if err := s.writeBlob(digest[:], "", content); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destPath), 0o755); err != nil {
+		return fmt.Errorf("cas: creating destination directory: %w", err)
+	}
+	os.Remove(destPath) // Link fails if destPath already exists.
+	if err := os.Link(path, destPath); err == nil {
+		return nil
+	}
+	// Cross-device links aren't possible; fall back to a copy.
+	return os.WriteFile(destPath, content, 0o644)
+}
+
+// Verify re-hashes every blob in the store against its filename and
+// returns an error describing the first mismatch it finds, or nil if the
+// store is intact.
+func (s *Store) Verify() error {
+	dir := filepath.Join(s.root, "sha256")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("cas: reading store directory: %w", err)
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		hexDigest, isMap := splitMapSuffix(name)
+
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("cas: reading %s: %w", name, err)
+		}
+		if isMap {
+			// A source map's filename is the digest of the source it
+			// belongs to, not of the map itself -- nothing to re-hash.
+			continue
+		}
+
+		digest := sha256.Sum256(content)
+		if hex.EncodeToString(digest[:]) != hexDigest {
+			return fmt.Errorf("cas: blob %s is corrupt (hash mismatch)", name)
+		}
+	}
+	return nil
+}
+
+func (s *Store) lookup(specifier string) (*storeEntry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tree.get(specifier)
+}
+
+func (s *Store) blobPath(digest []byte, suffix string) string {
+	return filepath.Join(s.root, "sha256", hex.EncodeToString(digest)+suffix)
+}
+
+// writeBlob writes content to the blob path for digest+suffix, atomically
+// (via a temp file and rename) and only if it isn't already there -- a
+// second Put of the same content is a no-op, which is the whole point of
+// content addressing.
+func (s *Store) writeBlob(digest []byte, suffix string, content []byte) error {
+	path := s.blobPath(digest, suffix)
+	if fileExists(path) {
+		return nil
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("cas: creating blob directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("cas: creating temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("cas: writing blob: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("cas: closing blob: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func splitMapSuffix(name string) (hexDigest string, isMap bool) {
+	const suffix = ".map"
+	if len(name) > len(suffix) && name[len(name)-len(suffix):] == suffix {
+		return name[:len(name)-len(suffix)], true
+	}
+	return name, false
+}
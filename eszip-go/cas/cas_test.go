@@ -0,0 +1,191 @@
+// Copyright 2018-2024 the Deno authors. All rights reserved. MIT license.
+
+package cas
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	eszip "github.com/example/eszip-go"
+)
+
+func TestStorePutAndMaterialize(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+
+	a := eszip.NewV2()
+	a.AddModule("file:///shared.js", eszip.ModuleKindJavaScript, []byte("export const x = 1;"), nil)
+	a.AddModule("file:///only-in-a.js", eszip.ModuleKindJavaScript, []byte("export const a = 2;"), nil)
+	unionA, err := parseRoundTrip(ctx, a)
+	if err != nil {
+		t.Fatalf("failed to round-trip archive a: %v", err)
+	}
+	if err := store.Put(ctx, unionA); err != nil {
+		t.Fatalf("failed to put archive a: %v", err)
+	}
+
+	b := eszip.NewV2()
+	b.AddModule("file:///shared.js", eszip.ModuleKindJavaScript, []byte("export const x = 1;"), nil)
+	unionB, err := parseRoundTrip(ctx, b)
+	if err != nil {
+		t.Fatalf("failed to round-trip archive b: %v", err)
+	}
+	if err := store.Put(ctx, unionB); err != nil {
+		t.Fatalf("failed to put archive b: %v", err)
+	}
+
+	source, err := store.Materialize("file:///shared.js")
+	if err != nil {
+		t.Fatalf("failed to materialize shared.js: %v", err)
+	}
+	if !bytes.Equal(source, []byte("export const x = 1;")) {
+		t.Errorf("unexpected materialized content: %q", source)
+	}
+
+	// Two archives sharing content should share on-disk bytes: exactly one
+	// blob should exist for it.
+	entries, err := os.ReadDir(filepath.Join(dir, "sha256"))
+	if err != nil {
+		t.Fatalf("failed to read store directory: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("expected 2 distinct blobs (shared.js + only-in-a.js), got %d", len(entries))
+	}
+}
+
+func TestStoreBuildEszip(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+
+	original := eszip.NewV2()
+	original.AddModule("file:///a.js", eszip.ModuleKindJavaScript, []byte("export const a = 1;"), []byte(`{"version":3}`))
+	original.AddModule("file:///b.json", eszip.ModuleKindJson, []byte(`{"b":2}`), nil)
+	union, err := parseRoundTrip(ctx, original)
+	if err != nil {
+		t.Fatalf("failed to round-trip original archive: %v", err)
+	}
+	if err := store.Put(ctx, union); err != nil {
+		t.Fatalf("failed to put archive: %v", err)
+	}
+
+	rebuilt, err := store.BuildEszip([]string{"file:///a.js", "file:///b.json"})
+	if err != nil {
+		t.Fatalf("failed to build eszip from store: %v", err)
+	}
+
+	module := rebuilt.GetModule("file:///a.js")
+	if module == nil {
+		t.Fatalf("expected to find a.js in rebuilt archive")
+	}
+	if module.Kind != eszip.ModuleKindJavaScript {
+		t.Errorf("expected javascript kind, got %s", module.Kind)
+	}
+	source, err := module.Source(ctx)
+	if err != nil {
+		t.Fatalf("failed to get source: %v", err)
+	}
+	if !bytes.Equal(source, []byte("export const a = 1;")) {
+		t.Errorf("unexpected source: %q", source)
+	}
+	sourceMap, err := module.SourceMap(ctx)
+	if err != nil {
+		t.Fatalf("failed to get source map: %v", err)
+	}
+	if !bytes.Equal(sourceMap, []byte(`{"version":3}`)) {
+		t.Errorf("unexpected source map: %q", sourceMap)
+	}
+}
+
+func TestStoreVerifyDetectsCorruption(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+
+	a := eszip.NewV2()
+	a.AddModule("file:///a.js", eszip.ModuleKindJavaScript, []byte("export const a = 1;"), nil)
+	union, err := parseRoundTrip(ctx, a)
+	if err != nil {
+		t.Fatalf("failed to round-trip archive: %v", err)
+	}
+	if err := store.Put(ctx, union); err != nil {
+		t.Fatalf("failed to put archive: %v", err)
+	}
+
+	if err := store.Verify(); err != nil {
+		t.Fatalf("expected a freshly-written store to verify clean: %v", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "sha256"))
+	if err != nil {
+		t.Fatalf("failed to read store directory: %v", err)
+	}
+	if len(entries) == 0 {
+		t.Fatalf("expected at least one blob")
+	}
+	corruptPath := filepath.Join(dir, "sha256", entries[0].Name())
+	if err := os.WriteFile(corruptPath, []byte("corrupted"), 0o644); err != nil {
+		t.Fatalf("failed to corrupt blob: %v", err)
+	}
+
+	if err := store.Verify(); err == nil {
+		t.Errorf("expected Verify to detect the corrupted blob")
+	}
+}
+
+func TestStoreLinkOrStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+
+	content := []byte("shared content")
+	destA := filepath.Join(t.TempDir(), "a.js")
+	destB := filepath.Join(t.TempDir(), "b.js")
+
+	if err := store.LinkOrStore(content, destA); err != nil {
+		t.Fatalf("failed to link/store for destA: %v", err)
+	}
+	if err := store.LinkOrStore(content, destB); err != nil {
+		t.Fatalf("failed to link/store for destB: %v", err)
+	}
+
+	infoA, err := os.Stat(destA)
+	if err != nil {
+		t.Fatalf("failed to stat destA: %v", err)
+	}
+	infoB, err := os.Stat(destB)
+	if err != nil {
+		t.Fatalf("failed to stat destB: %v", err)
+	}
+	if !os.SameFile(infoA, infoB) {
+		t.Errorf("expected destA and destB to be hardlinked to the same blob")
+	}
+}
+
+// parseRoundTrip serializes a V2 archive and reparses it as an EszipUnion,
+// mirroring how the CLI hands a freshly-built archive to the store.
+func parseRoundTrip(ctx context.Context, e *eszip.EszipV2) (*eszip.EszipUnion, error) {
+	data, err := e.IntoBytes()
+	if err != nil {
+		return nil, err
+	}
+	return eszip.ParseBytes(ctx, data)
+}
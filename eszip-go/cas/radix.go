@@ -0,0 +1,102 @@
+// Copyright 2018-2024 the Deno authors. All rights reserved. MIT license.
+
+package cas
+
+// radixNode is a node in an immutable radix tree mapping module specifiers
+// to storeEntry values. insert returns a new root via path copying instead
+// of mutating in place, so a Store reader holding an old root keeps seeing
+// a consistent snapshot while a concurrent Put is in flight -- the same
+// approach content-addressed build caches use for their specifier index.
+type radixNode struct {
+	prefix   string
+	value    *storeEntry
+	children []*radixNode
+}
+
+// get looks up key, following edges whose prefix matches a leading portion
+// of the remaining key.
+func (n *radixNode) get(key string) (*storeEntry, bool) {
+	if n == nil {
+		return nil, false
+	}
+	if !hasPrefix(key, n.prefix) {
+		return nil, false
+	}
+	rest := key[len(n.prefix):]
+	if rest == "" {
+		if n.value == nil {
+			return nil, false
+		}
+		return n.value, true
+	}
+	for _, c := range n.children {
+		if len(c.prefix) > 0 && rest[0] == c.prefix[0] {
+			return c.get(rest)
+		}
+	}
+	return nil, false
+}
+
+// insert returns a new tree with key mapped to value, leaving n and
+// everything reachable from it untouched.
+func (n *radixNode) insert(key string, value *storeEntry) *radixNode {
+	if n == nil {
+		return &radixNode{prefix: key, value: value}
+	}
+
+	common := commonPrefixLen(n.prefix, key)
+
+	switch {
+	case common == len(n.prefix) && common == len(key):
+		clone := *n
+		clone.value = value
+		return &clone
+
+	case common == len(n.prefix):
+		rest := key[common:]
+		children := make([]*radixNode, 0, len(n.children)+1)
+		inserted := false
+		for _, c := range n.children {
+			if len(c.prefix) > 0 && len(rest) > 0 && c.prefix[0] == rest[0] {
+				children = append(children, c.insert(rest, value))
+				inserted = true
+			} else {
+				children = append(children, c)
+			}
+		}
+		if !inserted {
+			children = append(children, &radixNode{prefix: rest, value: value})
+		}
+		clone := *n
+		clone.children = children
+		return &clone
+
+	case common == len(key):
+		// key is a strict prefix of n.prefix: n becomes a child below a
+		// new node holding key's value.
+		child := &radixNode{prefix: n.prefix[common:], value: n.value, children: n.children}
+		return &radixNode{prefix: key, value: value, children: []*radixNode{child}}
+
+	default:
+		// Neither is a prefix of the other: split at their common prefix.
+		existingChild := &radixNode{prefix: n.prefix[common:], value: n.value, children: n.children}
+		newChild := &radixNode{prefix: key[common:], value: value}
+		return &radixNode{prefix: key[:common], children: []*radixNode{existingChild, newChild}}
+	}
+}
+
+func hasPrefix(s, prefix string) bool {
+	return len(s) >= len(prefix) && s[:len(prefix)] == prefix
+}
+
+func commonPrefixLen(a, b string) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	i := 0
+	for i < n && a[i] == b[i] {
+		i++
+	}
+	return i
+}
@@ -4,14 +4,21 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"flag"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 
 	eszip "github.com/example/eszip-go"
+	"github.com/example/eszip-go/cas"
 )
 
 func main() {
@@ -31,6 +38,16 @@ func main() {
 		createCmd(os.Args[2:])
 	case "info", "i":
 		infoCmd(os.Args[2:])
+	case "export":
+		exportCmd(os.Args[2:])
+	case "import":
+		importCmd(os.Args[2:])
+	case "diff":
+		diffCmd(os.Args[2:])
+	case "patch":
+		patchCmd(os.Args[2:])
+	case "verify":
+		verifyCmd(os.Args[2:])
 	case "help", "-h", "--help":
 		printUsage()
 	default:
@@ -51,14 +68,27 @@ Commands:
   extract, x    Extract files from an eszip archive
   create, c     Create a new eszip archive from files
   info, i       Show information about an eszip archive
+  export        Convert an eszip archive to a tar, tar.gz, or zip file
+  import        Convert a tar, tar.gz, or zip file back into an eszip archive
+  diff          Compute a binary delta between two eszip archives
+  patch         Apply a delta from 'diff' to an eszip archive
+  verify        Check an archive's modules against a 'create -manifest' manifest
   help          Show this help message
 
 Examples:
   eszip view archive.eszip2
   eszip view -s file:///main.ts archive.eszip2
+  eszip view -s file:///main.ts https://example.com/app.eszip2
   eszip extract -o ./output archive.eszip2
   eszip create -o archive.eszip2 file1.js file2.js
   eszip info archive.eszip2
+  eszip export -f tar.gz -o bundle.tgz archive.eszip2
+  eszip import -i bundle.tgz -o archive.eszip2
+  eszip create -cas ./store -o archive.eszip2 main.js
+  eszip extract -cas ./store -o ./output archive.eszip2
+  eszip diff -o delta.eszipd old.eszip2 new.eszip2
+  eszip patch -o new.eszip2 base.eszip2 delta.eszipd
+  eszip verify -manifest release.txt archive.eszip2
 
 Run 'eszip <command> -h' for more information on a command.`)
 }
@@ -136,6 +166,7 @@ Options:`)
 func extractCmd(args []string) {
 	fs := flag.NewFlagSet("extract", flag.ExitOnError)
 	outputDir := fs.String("o", ".", "Output directory")
+	casDir := fs.String("cas", "", "Content-addressable store directory; extracted sources are hardlinked from here instead of copied")
 	fs.Usage = func() {
 		fmt.Println(`Usage: eszip extract [options] <archive>
 
@@ -160,6 +191,15 @@ Options:`)
 		os.Exit(1)
 	}
 
+	var store *cas.Store
+	if *casDir != "" {
+		store, err = cas.Open(*casDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening cas store: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	specifiers := archive.Specifiers()
 	for _, spec := range specifiers {
 		module := archive.GetModule(spec)
@@ -192,8 +232,15 @@ Options:`)
 			continue
 		}
 
-		// Write file
-		if err := os.WriteFile(fullPath, source, 0644); err != nil {
+		// Write file, routing through the cas store if one was given so
+		// that content shared with other archives is hardlinked instead
+		// of duplicated on disk.
+		if store != nil {
+			if err := store.LinkOrStore(source, fullPath); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing file: %v\n", err)
+				continue
+			}
+		} else if err := os.WriteFile(fullPath, source, 0644); err != nil {
 			fmt.Fprintf(os.Stderr, "Error writing file: %v\n", err)
 			continue
 		}
@@ -216,6 +263,10 @@ func createCmd(args []string) {
 	fs := flag.NewFlagSet("create", flag.ExitOnError)
 	outputPath := fs.String("o", "output.eszip2", "Output file path")
 	checksum := fs.String("checksum", "sha256", "Checksum algorithm (none, sha256, xxhash3)")
+	compression := fs.String("compression", "none", "Compression algorithm (none, gzip, zstd, brotli)")
+	casDir := fs.String("cas", "", "Content-addressable store directory; module sources are also saved here, deduplicated by content")
+	manifestPath := fs.String("manifest", "", "Write a signed-release-style manifest of per-module digests to this path")
+	signKeyfile := fs.String("sign", "", "Armored OpenPGP private key to sign -manifest with (requires -manifest)")
 	fs.Usage = func() {
 		fmt.Println(`Usage: eszip create [options] <files...>
 
@@ -226,7 +277,10 @@ Options:`)
 		fmt.Println(`
 Examples:
   eszip create -o app.eszip2 main.js utils.js
-  eszip create -checksum none -o app.eszip2 *.js`)
+  eszip create -checksum none -o app.eszip2 *.js
+  eszip create -compression gzip -o app.eszip2 main.js
+  eszip create -manifest release.txt -o app.eszip2 main.js
+  eszip create -manifest release.txt -sign signing-key.asc -o app.eszip2 main.js`)
 	}
 
 	fs.Parse(args)
@@ -234,6 +288,10 @@ Examples:
 		fs.Usage()
 		os.Exit(1)
 	}
+	if *signKeyfile != "" && *manifestPath == "" {
+		fmt.Fprintln(os.Stderr, "Error: -sign requires -manifest")
+		os.Exit(1)
+	}
 
 	archive := eszip.NewV2()
 
@@ -250,6 +308,21 @@ Examples:
 		os.Exit(1)
 	}
 
+	// Set compression
+	switch *compression {
+	case "none":
+		archive.SetCompression(eszip.CompressionNone)
+	case "gzip":
+		archive.SetCompression(eszip.CompressionGzip)
+	case "zstd":
+		archive.SetCompression(eszip.CompressionZstd)
+	case "brotli":
+		archive.SetCompression(eszip.CompressionBrotli)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown compression: %s\n", *compression)
+		os.Exit(1)
+	}
+
 	// Add files
 	for _, filePath := range fs.Args() {
 		absPath, err := filepath.Abs(filePath)
@@ -293,6 +366,63 @@ Examples:
 	}
 
 	fmt.Printf("Created: %s (%d bytes)\n", *outputPath, len(data))
+
+	if *casDir != "" {
+		store, err := cas.Open(*casDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening cas store: %v\n", err)
+			os.Exit(1)
+		}
+
+		union, err := eszip.ParseBytes(context.Background(), data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error re-parsing archive for cas store: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := store.Put(context.Background(), union); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing to cas store: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Stored in cas: %s\n", *casDir)
+	}
+
+	if *manifestPath != "" {
+		union, err := eszip.ParseBytes(context.Background(), data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error re-parsing archive for manifest: %v\n", err)
+			os.Exit(1)
+		}
+
+		manifest, err := eszip.BuildReleaseManifest(context.Background(), data, union)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error building manifest: %v\n", err)
+			os.Exit(1)
+		}
+
+		manifestData := manifest.Encode()
+		if err := os.WriteFile(*manifestPath, manifestData, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing manifest: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Manifest: %s (%d modules)\n", *manifestPath, len(manifest.Modules))
+
+		if *signKeyfile != "" {
+			signature, err := eszip.SignManifest(manifestData, *signKeyfile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error signing manifest: %v\n", err)
+				os.Exit(1)
+			}
+
+			sigPath := *manifestPath + ".asc"
+			if err := os.WriteFile(sigPath, signature, 0644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing signature: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Signature: %s\n", sigPath)
+		}
+	}
 }
 
 // infoCmd handles the 'info' command
@@ -313,11 +443,17 @@ Show information about an eszip archive.`)
 	archivePath := fs.Arg(0)
 	ctx := context.Background()
 
-	// Get file size
-	stat, err := os.Stat(archivePath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	// Get file size; remote archives don't have one available up front.
+	var size int64
+	var sizeKnown bool
+	if !isRemoteURL(archivePath) {
+		stat, err := os.Stat(archivePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		size = stat.Size()
+		sizeKnown = true
 	}
 
 	archive, err := loadArchive(ctx, archivePath)
@@ -329,7 +465,9 @@ Show information about an eszip archive.`)
 	specifiers := archive.Specifiers()
 
 	fmt.Printf("File: %s\n", archivePath)
-	fmt.Printf("Size: %d bytes\n", stat.Size())
+	if sizeKnown {
+		fmt.Printf("Size: %d bytes\n", size)
+	}
 
 	if archive.IsV1() {
 		fmt.Println("Format: V1 (JSON)")
@@ -343,6 +481,7 @@ Show information about an eszip archive.`)
 	kindCounts := make(map[eszip.ModuleKind]int)
 	redirectCount := 0
 	totalSourceSize := 0
+	var totalCompressedSize, totalUncompressedSize uint64
 
 	for _, spec := range specifiers {
 		module := archive.GetModule(spec)
@@ -354,6 +493,23 @@ Show information about an eszip archive.`)
 
 		source, _ := module.Source(ctx)
 		totalSourceSize += len(source)
+
+		if archive.IsV2() {
+			if compressed, uncompressed, ok := archive.V2().SourceSizes(spec); ok {
+				totalCompressedSize += uint64(compressed)
+				totalUncompressedSize += uint64(uncompressed)
+			}
+		}
+	}
+
+	if archive.IsV2() {
+		compression := archive.V2().Options().Compression
+		fmt.Printf("Compression: %s\n", compression)
+		if compression != eszip.CompressionNone && totalUncompressedSize > 0 {
+			ratio := float64(totalCompressedSize) / float64(totalUncompressedSize)
+			fmt.Printf("Source bytes: %d compressed, %d uncompressed (ratio %.2f)\n",
+				totalCompressedSize, totalUncompressedSize, ratio)
+		}
 	}
 
 	fmt.Println("\nModule types:")
@@ -376,7 +532,317 @@ Show information about an eszip archive.`)
 	}
 }
 
+// exportCmd handles the 'export' command
+func exportCmd(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("f", "tar.gz", "Output format (tar, tar.gz, zip)")
+	outputPath := fs.String("o", "", "Output file path")
+	fs.Usage = func() {
+		fmt.Println(`Usage: eszip export -o <output> [options] <archive>
+
+Convert an eszip archive into a standard tar, tar.gz, or zip file
+containing its sources, source maps, and a manifest describing how to
+rebuild an equivalent archive with 'eszip import'.
+
+Options:`)
+		fs.PrintDefaults()
+	}
+
+	fs.Parse(args)
+	if fs.NArg() < 1 || *outputPath == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	archivePath := fs.Arg(0)
+	ctx := context.Background()
+
+	archive, err := loadArchive(ctx, archivePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if !archive.IsV2() {
+		fmt.Fprintln(os.Stderr, "Error: export only supports V2 archives")
+		os.Exit(1)
+	}
+
+	out, err := os.Create(*outputPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
+		os.Exit(1)
+	}
+	defer out.Close()
+
+	switch *format {
+	case "tar":
+		err = archive.V2().WriteAsTar(ctx, out)
+	case "tar.gz", "tgz":
+		gw := gzip.NewWriter(out)
+		if err = archive.V2().WriteAsTar(ctx, gw); err == nil {
+			err = gw.Close()
+		}
+	case "zip":
+		err = archive.V2().WriteAsZip(ctx, out)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown format: %s (expected tar, tar.gz, or zip)\n", *format)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error exporting archive: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Exported: %s\n", *outputPath)
+}
+
+// importCmd handles the 'import' command
+func importCmd(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	inputPath := fs.String("i", "", "Input file path (tar, tar.gz, or zip)")
+	outputPath := fs.String("o", "output.eszip2", "Output eszip file path")
+	fs.Usage = func() {
+		fmt.Println(`Usage: eszip import -i <input> [options]
+
+Convert a tar, tar.gz, or zip file previously written by 'eszip export'
+back into an eszip archive.
+
+Options:`)
+		fs.PrintDefaults()
+	}
+
+	fs.Parse(args)
+	if *inputPath == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	data, err := os.ReadFile(*inputPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading input file: %v\n", err)
+		os.Exit(1)
+	}
+
+	var archive *eszip.EszipV2
+	switch {
+	case strings.HasSuffix(*inputPath, ".zip"):
+		archive, err = eszip.FromZip(bytes.NewReader(data), int64(len(data)))
+	case strings.HasSuffix(*inputPath, ".tar.gz"), strings.HasSuffix(*inputPath, ".tgz"):
+		gr, gzErr := gzip.NewReader(bytes.NewReader(data))
+		if gzErr != nil {
+			fmt.Fprintf(os.Stderr, "Error reading gzip stream: %v\n", gzErr)
+			os.Exit(1)
+		}
+		archive, err = eszip.FromTar(gr)
+	default:
+		archive, err = eszip.FromTar(bytes.NewReader(data))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error importing archive: %v\n", err)
+		os.Exit(1)
+	}
+
+	serialized, err := archive.IntoBytes()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error serializing archive: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := os.WriteFile(*outputPath, serialized, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Imported: %s (%d bytes)\n", *outputPath, len(serialized))
+}
+
+// diffCmd handles the 'diff' command
+func diffCmd(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	outputPath := fs.String("o", "delta.eszipd", "Output delta file path")
+	fs.Usage = func() {
+		fmt.Println(`Usage: eszip diff -o <delta> <old.eszip2> <new.eszip2>
+
+Compute a binary delta between two eszip archives, suitable for shipping
+an incremental update with 'eszip patch' instead of the full new archive.
+
+Options:`)
+		fs.PrintDefaults()
+	}
+
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+
+	oldArchive, err := loadArchive(ctx, fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", fs.Arg(0), err)
+		os.Exit(1)
+	}
+	newArchive, err := loadArchive(ctx, fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", fs.Arg(1), err)
+		os.Exit(1)
+	}
+
+	delta, err := eszip.DiffArchives(ctx, oldArchive, newArchive)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error diffing archives: %v\n", err)
+		os.Exit(1)
+	}
+
+	data, err := delta.IntoBytes()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error serializing delta: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := os.WriteFile(*outputPath, data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Added: %d, Changed: %d, Removed: %d\n", len(delta.Added), len(delta.Changed), len(delta.RemovedSpecifiers))
+	fmt.Printf("Created: %s (%d bytes)\n", *outputPath, len(data))
+}
+
+// patchCmd handles the 'patch' command
+func patchCmd(args []string) {
+	fs := flag.NewFlagSet("patch", flag.ExitOnError)
+	outputPath := fs.String("o", "output.eszip2", "Output eszip file path")
+	fs.Usage = func() {
+		fmt.Println(`Usage: eszip patch -o <output> <base.eszip2> <delta.eszipd>
+
+Apply a delta produced by 'eszip diff' to a base archive, reconstructing
+the new archive it was diffed against.
+
+Options:`)
+		fs.PrintDefaults()
+	}
+
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+
+	base, err := loadArchive(ctx, fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", fs.Arg(0), err)
+		os.Exit(1)
+	}
+
+	deltaData, err := os.ReadFile(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading delta file: %v\n", err)
+		os.Exit(1)
+	}
+	delta, err := eszip.ParseArchiveDelta(deltaData)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing delta: %v\n", err)
+		os.Exit(1)
+	}
+
+	patched, err := eszip.ApplyPatch(ctx, base, delta)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error applying patch: %v\n", err)
+		os.Exit(1)
+	}
+
+	data, err := patched.IntoBytes()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error serializing patched archive: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := os.WriteFile(*outputPath, data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Patched: %s (%d bytes)\n", *outputPath, len(data))
+}
+
+// verifyCmd handles the 'verify' command
+func verifyCmd(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	manifestPath := fs.String("manifest", "", "Manifest produced by 'create -manifest' to verify against")
+	fs.Usage = func() {
+		fmt.Println(`Usage: eszip verify -manifest <release.txt> <archive>
+
+Recompute every module's digests from an eszip archive and report any
+that don't match a manifest produced by 'eszip create -manifest'.
+
+Options:`)
+		fs.PrintDefaults()
+	}
+
+	fs.Parse(args)
+	if fs.NArg() < 1 || *manifestPath == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	archivePath := fs.Arg(0)
+	ctx := context.Background()
+
+	manifestData, err := os.ReadFile(*manifestPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading manifest: %v\n", err)
+		os.Exit(1)
+	}
+	manifest, err := eszip.ParseReleaseManifest(manifestData)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing manifest: %v\n", err)
+		os.Exit(1)
+	}
+
+	// The archive file's own bytes are only available for a local path;
+	// a remote archive is verified module-by-module without them.
+	var archiveData []byte
+	if !isRemoteURL(archivePath) {
+		archiveData, err = os.ReadFile(archivePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	archive, err := loadArchive(ctx, archivePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	mismatches, err := manifest.Verify(ctx, archiveData, archive)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error verifying archive: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(mismatches) == 0 {
+		fmt.Printf("OK: %s matches %s (%d modules)\n", archivePath, *manifestPath, len(manifest.Modules))
+		return
+	}
+
+	for _, mismatch := range mismatches {
+		fmt.Printf("MISMATCH: %s: %s\n", mismatch.Specifier, mismatch.Reason)
+	}
+	fmt.Fprintf(os.Stderr, "%d mismatch(es) found\n", len(mismatches))
+	os.Exit(1)
+}
+
 func loadArchive(ctx context.Context, path string) (*eszip.EszipUnion, error) {
+	if isRemoteURL(path) {
+		return loadRemoteArchive(ctx, path)
+	}
+
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file: %w", err)
@@ -385,6 +851,123 @@ func loadArchive(ctx context.Context, path string) (*eszip.EszipUnion, error) {
 	return eszip.ParseBytes(ctx, data)
 }
 
+func isRemoteURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// loadRemoteArchive fetches an eszip archive served at url. It prefers
+// eszip.OpenRemote, which only downloads the header and module index up
+// front and resolves each module's source with its own ranged GET -- ideal
+// for 'eszip view -s', which never touches the network for specifiers it
+// isn't asked to show. Servers that don't support ranged requests fall back
+// to a full streaming download, checked against an ETag cache under
+// ~/.cache/eszip so an unchanged archive is never refetched.
+func loadRemoteArchive(ctx context.Context, url string) (*eszip.EszipUnion, error) {
+	if archive, err := eszip.OpenRemote(ctx, url); err == nil {
+		return archive, nil
+	}
+
+	cachedData, cachedETag, _ := readRemoteCache(url)
+	return fetchRemoteArchive(ctx, url, cachedData, cachedETag)
+}
+
+func fetchRemoteArchive(ctx context.Context, url string, cachedData []byte, cachedETag string) (*eszip.EszipUnion, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	if cachedETag != "" {
+		req.Header.Set("If-None-Match", cachedETag)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		if cachedData == nil {
+			return nil, fmt.Errorf("server reported %s unchanged but no local cache was found", url)
+		}
+		return eszip.ParseBytes(ctx, cachedData)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: status %s", url, resp.Status)
+	}
+
+	var body io.Reader = resp.Body
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress response from %s: %w", url, err)
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	var buf bytes.Buffer
+	archive, complete, err := eszip.Parse(ctx, io.TeeReader(body, &buf))
+	if err != nil {
+		return nil, err
+	}
+	if err := complete(ctx); err != nil {
+		return nil, err
+	}
+
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		writeRemoteCache(url, buf.Bytes(), etag)
+	}
+
+	return archive, nil
+}
+
+// remoteCachePaths returns where loadRemoteArchive stores the cached bytes
+// and ETag for url, keyed by its sha256 hash so arbitrary URLs map to safe
+// file names. Returns "" for both if the user's home directory can't be
+// determined, in which case the cache is simply skipped.
+func remoteCachePaths(url string) (dataPath, etagPath string) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", ""
+	}
+	sum := sha256.Sum256([]byte(url))
+	key := hex.EncodeToString(sum[:])
+	dir := filepath.Join(home, ".cache", "eszip")
+	return filepath.Join(dir, key+".eszip2"), filepath.Join(dir, key+".etag")
+}
+
+func readRemoteCache(url string) (data []byte, etag string, ok bool) {
+	dataPath, etagPath := remoteCachePaths(url)
+	if dataPath == "" {
+		return nil, "", false
+	}
+	data, err := os.ReadFile(dataPath)
+	if err != nil {
+		return nil, "", false
+	}
+	etagBytes, err := os.ReadFile(etagPath)
+	if err != nil {
+		return nil, "", false
+	}
+	return data, string(etagBytes), true
+}
+
+func writeRemoteCache(url string, data []byte, etag string) {
+	dataPath, etagPath := remoteCachePaths(url)
+	if dataPath == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(dataPath), 0755); err != nil {
+		return
+	}
+	if err := os.WriteFile(dataPath, data, 0644); err != nil {
+		return
+	}
+	os.WriteFile(etagPath, []byte(etag), 0644)
+}
+
 func specifierToPath(specifier string) string {
 	// Remove protocol prefixes
 	path := specifier
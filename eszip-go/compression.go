@@ -0,0 +1,128 @@
+// Copyright 2018-2024 the Deno authors. All rights reserved. MIT license.
+
+package eszip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressionType represents the algorithm used to compress each entry of
+// the sources and sourceMaps sections.
+type CompressionType uint8
+
+const (
+	CompressionNone   CompressionType = 0
+	CompressionGzip   CompressionType = 1
+	CompressionZstd   CompressionType = 2
+	CompressionBrotli CompressionType = 3
+)
+
+// CompressionFromU8 creates a CompressionType from a byte value
+func CompressionFromU8(b uint8) (CompressionType, bool) {
+	switch b {
+	case 0:
+		return CompressionNone, true
+	case 1:
+		return CompressionGzip, true
+	case 2:
+		return CompressionZstd, true
+	case 3:
+		return CompressionBrotli, true
+	default:
+		return CompressionNone, false
+	}
+}
+
+// Compress encodes data with the receiver's algorithm. An empty input
+// always encodes to an empty output so empty sources/source maps stay
+// empty on disk.
+func (c CompressionType) Compress(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+
+	switch c {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer enc.Close()
+		return enc.EncodeAll(data, nil), nil
+	case CompressionBrotli:
+		var buf bytes.Buffer
+		w := brotli.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown compression type %d", c)
+	}
+}
+
+// Decompress decodes data previously produced by Compress.
+func (c CompressionType) Decompress(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+
+	switch c {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	case CompressionZstd:
+		dec, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer dec.Close()
+		return dec.DecodeAll(data, nil)
+	case CompressionBrotli:
+		return io.ReadAll(brotli.NewReader(bytes.NewReader(data)))
+	default:
+		return nil, fmt.Errorf("unknown compression type %d", c)
+	}
+}
+
+func (c CompressionType) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZstd:
+		return "zstd"
+	case CompressionBrotli:
+		return "brotli"
+	default:
+		return "unknown"
+	}
+}
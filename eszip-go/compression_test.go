@@ -0,0 +1,73 @@
+// Copyright 2018-2024 the Deno authors. All rights reserved. MIT license.
+
+package eszip
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// denoModuleGraphSources returns synthetic JS sources shaped like a typical
+// Deno module graph: a handful of large, repetitive vendored dependencies
+// (compress well) alongside many small, more entropic application modules
+// (compress poorly), so the benchmark reflects a realistic mix rather than
+// a best- or worst-case payload.
+func denoModuleGraphSources() [][]byte {
+	rng := rand.New(rand.NewSource(1))
+	var sources [][]byte
+
+	for i := 0; i < 5; i++ {
+		var vendored []byte
+		for len(vendored) < 200<<10 {
+			vendored = append(vendored, []byte(fmt.Sprintf(
+				"export function helper%d(x) { return x + %d; }\n", i, i))...)
+		}
+		sources = append(sources, vendored)
+	}
+
+	for i := 0; i < 50; i++ {
+		app := make([]byte, 4<<10)
+		rng.Read(app)
+		sources = append(sources, app)
+	}
+
+	return sources
+}
+
+func buildCompressedArchive(b *testing.B, compression CompressionType) []byte {
+	b.Helper()
+
+	sources := denoModuleGraphSources()
+	e := NewV2()
+	e.SetCompression(compression)
+	for i, source := range sources {
+		e.AddModule(fmt.Sprintf("file:///mod%d.js", i), ModuleKindJavaScript, source, nil)
+	}
+
+	data, err := e.IntoBytes()
+	if err != nil {
+		b.Fatalf("failed to serialize archive: %v", err)
+	}
+	return data
+}
+
+// BenchmarkParseThroughputCompression compares ParseBytes throughput across
+// compression codecs on a representative Deno module graph. Run with:
+// go test -bench ParseThroughputCompression -run ^$
+func BenchmarkParseThroughputCompression(b *testing.B) {
+	for _, compression := range []CompressionType{CompressionNone, CompressionGzip, CompressionZstd} {
+		b.Run(compression.String(), func(b *testing.B) {
+			data := buildCompressedArchive(b, compression)
+			b.SetBytes(int64(len(data)))
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := ParseBytes(context.Background(), data); err != nil {
+					b.Fatalf("ParseBytes failed: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -32,6 +32,16 @@ type ParseError struct {
 	Type    ParseErrorType
 	Message string
 	Offset  int
+
+	// Specifier is the module specifier involved in the error, when one is
+	// known (e.g. ErrInvalidV2SourceHash).
+	Specifier string
+	// PackageName is the npm package name or dependency requirement
+	// involved in the error, when one is known (e.g. ErrInvalidV2NpmPackage,
+	// ErrInvalidV2NpmPackageReq).
+	PackageName string
+
+	err error
 }
 
 func (e *ParseError) Error() string {
@@ -41,10 +51,51 @@ func (e *ParseError) Error() string {
 	return fmt.Sprintf("eszip parse error: %s", e.Message)
 }
 
+// Unwrap returns the underlying error, if any -- e.g. the io.Reader error
+// wrapped by errIO -- so errors.Is/As can see through a ParseError to the
+// original cause.
+func (e *ParseError) Unwrap() error {
+	return e.err
+}
+
+// Is reports whether target is one of the sentinel ParseErrors below with
+// the same Type, so callers can do errors.Is(err, eszip.ErrV2HeaderHashMismatch)
+// without caring about the Message/Offset/Specifier of the specific error.
+func (e *ParseError) Is(target error) bool {
+	t, ok := target.(*ParseError)
+	if !ok {
+		return false
+	}
+	return e.Type == t.Type
+}
+
+// Sentinel ParseErrors, one per ParseErrorType, for use with errors.Is.
+// These carry only a Type and are never returned directly -- match against
+// them to branch on error category instead of string-matching Error().
+var (
+	ErrV1InvalidJSON                = &ParseError{Type: ErrInvalidV1Json}
+	ErrV1InvalidVersion             = &ParseError{Type: ErrInvalidV1Version}
+	ErrV2Invalid                    = &ParseError{Type: ErrInvalidV2}
+	ErrV2HeaderHashMismatch         = &ParseError{Type: ErrInvalidV2HeaderHash}
+	ErrV2InvalidSpecifier           = &ParseError{Type: ErrInvalidV2Specifier}
+	ErrV2InvalidEntryKind           = &ParseError{Type: ErrInvalidV2EntryKind}
+	ErrV2InvalidModuleKind          = &ParseError{Type: ErrInvalidV2ModuleKind}
+	ErrV2InvalidHeader              = &ParseError{Type: ErrInvalidV2Header}
+	ErrV2InvalidSourceOffset        = &ParseError{Type: ErrInvalidV2SourceOffset}
+	ErrV2SourceHashMismatch         = &ParseError{Type: ErrInvalidV2SourceHash}
+	ErrV2NpmSnapshotHashMismatch    = &ParseError{Type: ErrInvalidV2NpmSnapshotHash}
+	ErrV2InvalidNpmPackageOffset    = &ParseError{Type: ErrInvalidV2NpmPackageOffset}
+	ErrV2InvalidNpmPackage          = &ParseError{Type: ErrInvalidV2NpmPackage}
+	ErrV2InvalidNpmPackageReq       = &ParseError{Type: ErrInvalidV2NpmPackageReq}
+	ErrV22InvalidOptionsHeader      = &ParseError{Type: ErrInvalidV22OptionsHeader}
+	ErrV22OptionsHeaderHashMismatch = &ParseError{Type: ErrInvalidV22OptionsHeaderHash}
+	ErrIOFailure                    = &ParseError{Type: ErrIO}
+)
+
 // Error constructors for common parse errors
 
 func errInvalidV1Json(err error) *ParseError {
-	return &ParseError{Type: ErrInvalidV1Json, Message: fmt.Sprintf("invalid eszip v1 json: %v", err)}
+	return &ParseError{Type: ErrInvalidV1Json, Message: fmt.Sprintf("invalid eszip v1 json: %v", err), err: err}
 }
 
 func errInvalidV1Version(version uint32) *ParseError {
@@ -80,7 +131,7 @@ func errInvalidV2SourceOffset(offset int) *ParseError {
 }
 
 func errInvalidV2SourceHash(specifier string) *ParseError {
-	return &ParseError{Type: ErrInvalidV2SourceHash, Message: fmt.Sprintf("invalid eszip v2 source hash (specifier %s)", specifier)}
+	return &ParseError{Type: ErrInvalidV2SourceHash, Message: fmt.Sprintf("invalid eszip v2 source hash (specifier %s)", specifier), Specifier: specifier}
 }
 
 func errInvalidV2NpmSnapshotHash() *ParseError {
@@ -88,15 +139,15 @@ func errInvalidV2NpmSnapshotHash() *ParseError {
 }
 
 func errInvalidV2NpmPackageOffset(index int, err error) *ParseError {
-	return &ParseError{Type: ErrInvalidV2NpmPackageOffset, Message: fmt.Sprintf("invalid eszip v2.1 npm package at index %d: %v", index, err)}
+	return &ParseError{Type: ErrInvalidV2NpmPackageOffset, Message: fmt.Sprintf("invalid eszip v2.1 npm package at index %d: %v", index, err), err: err}
 }
 
 func errInvalidV2NpmPackage(name string, err error) *ParseError {
-	return &ParseError{Type: ErrInvalidV2NpmPackage, Message: fmt.Sprintf("invalid eszip v2.1 npm package '%s': %v", name, err)}
+	return &ParseError{Type: ErrInvalidV2NpmPackage, Message: fmt.Sprintf("invalid eszip v2.1 npm package '%s': %v", name, err), PackageName: name, err: err}
 }
 
 func errInvalidV2NpmPackageReq(req string, err error) *ParseError {
-	return &ParseError{Type: ErrInvalidV2NpmPackageReq, Message: fmt.Sprintf("invalid eszip v2.1 npm req '%s': %v", req, err)}
+	return &ParseError{Type: ErrInvalidV2NpmPackageReq, Message: fmt.Sprintf("invalid eszip v2.1 npm req '%s': %v", req, err), PackageName: req, err: err}
 }
 
 func errInvalidV22OptionsHeader(msg string) *ParseError {
@@ -108,5 +159,5 @@ func errInvalidV22OptionsHeaderHash() *ParseError {
 }
 
 func errIO(err error) *ParseError {
-	return &ParseError{Type: ErrIO, Message: fmt.Sprintf("io error: %v", err)}
+	return &ParseError{Type: ErrIO, Message: fmt.Sprintf("io error: %v", err), err: err}
 }
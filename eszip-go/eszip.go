@@ -92,6 +92,15 @@ func (e *EszipUnion) TakeNpmSnapshot() *NpmResolutionSnapshot {
 	return e.v2.TakeNpmSnapshot()
 }
 
+// NpmSnapshot returns the NPM snapshot without removing it, or nil for V1
+// archives or V2 archives with none set.
+func (e *EszipUnion) NpmSnapshot() *NpmResolutionSnapshot {
+	if e.v1 != nil {
+		return nil
+	}
+	return e.v2.NpmSnapshot()
+}
+
 // Parse parses an eszip archive from the given reader.
 // Returns the eszip and a function to complete parsing of source data (for streaming).
 // The completion function must be called to fully load sources.
@@ -135,6 +144,63 @@ func Parse(ctx context.Context, r io.Reader) (*EszipUnion, func(context.Context)
 	return &EszipUnion{v1: eszip}, complete, nil
 }
 
+// ParseStream parses an eszip archive incrementally. The header and modules
+// section are read synchronously, so GetModule/Specifiers on the returned
+// archive are usable as soon as ParseStream returns; the remaining section
+// bytes are then read from r in the background, calling SourceSlot.SetReady
+// per specifier as they arrive, so a goroutine blocked in Module.Source(ctx)
+// unblocks incrementally rather than waiting for the whole stream.
+//
+// The module channel delivers every module as soon as ParseStream returns,
+// since specifiers and kinds are already known at that point, and is closed
+// once all of them have been sent. The error channel receives at most one
+// error -- from the initial header parse, or from a later checksum mismatch
+// -- and is then closed. Cancelling ctx stops the module channel from
+// sending further values; it does not interrupt the background read of r,
+// and an in-progress Module.Source/SourceMap call returns early only when
+// the ctx passed to that call is done.
+func ParseStream(ctx context.Context, r io.Reader) (*EszipUnion, <-chan *Module, <-chan error) {
+	modules := make(chan *Module)
+	errs := make(chan error, 1)
+
+	eszip, complete, err := Parse(ctx, r)
+	if err != nil {
+		close(modules)
+		errs <- err
+		close(errs)
+		return nil, modules, errs
+	}
+
+	go func() {
+		defer close(modules)
+		for _, specifier := range eszip.Specifiers() {
+			module := eszip.GetModule(specifier)
+			if module == nil {
+				// JSONC modules and import maps aren't returned by
+				// GetModule; fall back so every specifier is still sent.
+				module = eszip.GetImportMap(specifier)
+			}
+			if module == nil {
+				continue
+			}
+			select {
+			case modules <- module:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer close(errs)
+		if err := complete(ctx); err != nil {
+			errs <- err
+		}
+	}()
+
+	return eszip, modules, errs
+}
+
 // ParseSync parses an eszip archive completely (blocking)
 func ParseSync(ctx context.Context, r io.Reader) (*EszipUnion, error) {
 	eszip, complete, err := Parse(ctx, r)
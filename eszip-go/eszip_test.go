@@ -3,10 +3,18 @@
 package eszip
 
 import (
+	"archive/tar"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseV1(t *testing.T) {
@@ -133,6 +141,54 @@ func TestV2Redirect(t *testing.T) {
 	}
 }
 
+func TestV2RedirectChain(t *testing.T) {
+	data, err := os.ReadFile("testdata/redirect.eszip2")
+	if err != nil {
+		t.Fatalf("failed to read test file: %v", err)
+	}
+
+	ctx := context.Background()
+	eszip, err := ParseBytes(ctx, data)
+	if err != nil {
+		t.Fatalf("failed to parse eszip: %v", err)
+	}
+
+	module := eszip.V2().GetModule("file:///a.ts")
+	if module == nil {
+		t.Fatal("expected to find module: file:///a.ts")
+	}
+
+	if module.Specifier != "file:///b.ts" {
+		t.Errorf("expected resolved specifier file:///b.ts, got %s", module.Specifier)
+	}
+	if module.RequestedSpecifier != "file:///a.ts" {
+		t.Errorf("expected requested specifier file:///a.ts, got %s", module.RequestedSpecifier)
+	}
+
+	final, chain, ok := eszip.V2().ResolveSpecifier("file:///a.ts")
+	if !ok {
+		t.Fatal("expected ResolveSpecifier to succeed")
+	}
+	if final != "file:///b.ts" {
+		t.Errorf("expected final specifier file:///b.ts, got %s", final)
+	}
+	wantChain := []string{"file:///a.ts", "file:///b.ts"}
+	if len(chain) != len(wantChain) {
+		t.Fatalf("expected chain %v, got %v", wantChain, chain)
+	}
+	for i := range wantChain {
+		if chain[i] != wantChain[i] {
+			t.Errorf("expected chain %v, got %v", wantChain, chain)
+			break
+		}
+	}
+
+	redirects := eszip.V2().Redirects()
+	if redirects["file:///a.ts"] != "file:///b.ts" {
+		t.Errorf("expected Redirects()[file:///a.ts] == file:///b.ts, got %s", redirects["file:///a.ts"])
+	}
+}
+
 func TestTakeSource(t *testing.T) {
 	data, err := os.ReadFile("testdata/basic.json")
 	if err != nil {
@@ -356,6 +412,57 @@ func TestChecksumTypes(t *testing.T) {
 	}
 }
 
+func TestParseErrorIsAndAs(t *testing.T) {
+	ctx := context.Background()
+
+	eszip := NewV2()
+	eszip.SetChecksum(ChecksumSha256)
+	eszip.AddModule("file:///test.js", ModuleKindJavaScript, []byte("console.log('hi');"), nil)
+
+	data, err := eszip.IntoBytes()
+	if err != nil {
+		t.Fatalf("failed to serialize: %v", err)
+	}
+
+	// Corrupt a byte inside the source content itself (found by its known
+	// plaintext, since compression is off by default) so its checksum no
+	// longer matches, without touching any length prefix.
+	corrupted := append([]byte(nil), data...)
+	idx := bytes.Index(corrupted, []byte("console.log"))
+	if idx < 0 {
+		t.Fatal("expected to find source content in serialized archive")
+	}
+	corrupted[idx] ^= 0xff
+
+	_, err = ParseBytes(ctx, corrupted)
+	if err == nil {
+		t.Fatal("expected a checksum error")
+	}
+	if !errors.Is(err, ErrV2SourceHashMismatch) {
+		t.Errorf("expected errors.Is to match ErrV2SourceHashMismatch, got %v", err)
+	}
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected errors.As to yield a *ParseError, got %v", err)
+	}
+	if pe.Specifier != "file:///test.js" {
+		t.Errorf("expected Specifier %q, got %q", "file:///test.js", pe.Specifier)
+	}
+
+	// Truncating the archive entirely should surface as an IO error that
+	// unwraps to the underlying io error.
+	_, err = ParseBytes(ctx, data[:4])
+	if err == nil {
+		t.Fatal("expected an IO error")
+	}
+	if !errors.Is(err, ErrIOFailure) {
+		t.Errorf("expected errors.Is to match ErrIOFailure, got %v", err)
+	}
+	if errors.Unwrap(err) == nil {
+		t.Error("expected Unwrap to return the underlying io error")
+	}
+}
+
 func TestModuleKinds(t *testing.T) {
 	testCases := []struct {
 		kind ModuleKind
@@ -377,6 +484,190 @@ func TestModuleKinds(t *testing.T) {
 	}
 }
 
+func TestV2ResolveSpecifier(t *testing.T) {
+	eszip := NewV2()
+	eszip.AddModule("file:///c.js", ModuleKindJavaScript, []byte("console.log('c');"), nil)
+	eszip.AddRedirect("file:///b.js", "file:///c.js")
+	eszip.AddRedirect("file:///a.js", "file:///b.js")
+
+	module := eszip.GetModule("file:///a.js")
+	if module == nil {
+		t.Fatal("expected to find module via redirect chain")
+	}
+	if module.Specifier != "file:///c.js" {
+		t.Errorf("expected resolved specifier file:///c.js, got %s", module.Specifier)
+	}
+	if module.RequestedSpecifier != "file:///a.js" {
+		t.Errorf("expected requested specifier file:///a.js, got %s", module.RequestedSpecifier)
+	}
+
+	final, chain, ok := eszip.ResolveSpecifier("file:///a.js")
+	if !ok {
+		t.Fatal("expected ResolveSpecifier to succeed")
+	}
+	if final != "file:///c.js" {
+		t.Errorf("expected final specifier file:///c.js, got %s", final)
+	}
+	wantChain := []string{"file:///a.js", "file:///b.js", "file:///c.js"}
+	if len(chain) != len(wantChain) {
+		t.Fatalf("expected chain %v, got %v", wantChain, chain)
+	}
+	for i := range wantChain {
+		if chain[i] != wantChain[i] {
+			t.Errorf("expected chain %v, got %v", wantChain, chain)
+			break
+		}
+	}
+
+	redirects := eszip.Redirects()
+	if len(redirects) != 2 || redirects["file:///a.js"] != "file:///b.js" || redirects["file:///b.js"] != "file:///c.js" {
+		t.Errorf("unexpected redirects map: %v", redirects)
+	}
+
+	if _, _, ok := eszip.ResolveSpecifier("file:///missing.js"); ok {
+		t.Error("expected ResolveSpecifier to fail for a missing specifier")
+	}
+}
+
+func TestV2ChunkingRoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	eszip := NewV2()
+	eszip.SetChunking(true)
+
+	// Two modules sharing a large common prefix, so chunking should dedup
+	// the chunks that cover it.
+	shared := bytes.Repeat([]byte("console.log('shared code');\n"), 4000)
+	eszip.AddModule("file:///a.js", ModuleKindJavaScript, append(append([]byte{}, shared...), []byte("console.log('a');")...), nil)
+	eszip.AddModule("file:///b.js", ModuleKindJavaScript, append(append([]byte{}, shared...), []byte("console.log('b');")...), nil)
+
+	data, err := eszip.IntoBytes()
+	if err != nil {
+		t.Fatalf("failed to serialize eszip: %v", err)
+	}
+
+	parsed, err := ParseBytes(ctx, data)
+	if err != nil {
+		t.Fatalf("failed to parse serialized eszip: %v", err)
+	}
+
+	moduleA := parsed.GetModule("file:///a.js")
+	if moduleA == nil {
+		t.Fatal("expected to find module a")
+	}
+	sourceA, err := moduleA.Source(ctx)
+	if err != nil {
+		t.Fatalf("failed to get source a: %v", err)
+	}
+	if want := string(shared) + "console.log('a');"; string(sourceA) != want {
+		t.Errorf("source a mismatch")
+	}
+
+	moduleB := parsed.GetModule("file:///b.js")
+	if moduleB == nil {
+		t.Fatal("expected to find module b")
+	}
+	sourceB, err := moduleB.Source(ctx)
+	if err != nil {
+		t.Fatalf("failed to get source b: %v", err)
+	}
+	if want := string(shared) + "console.log('b');"; string(sourceB) != want {
+		t.Errorf("source b mismatch")
+	}
+
+	// The dedup should have made the chunked archive meaningfully smaller
+	// than storing both copies of the shared prefix in full.
+	eszipNoChunking := NewV2()
+	eszipNoChunking.AddModule("file:///a.js", ModuleKindJavaScript, append(append([]byte{}, shared...), []byte("console.log('a');")...), nil)
+	eszipNoChunking.AddModule("file:///b.js", ModuleKindJavaScript, append(append([]byte{}, shared...), []byte("console.log('b');")...), nil)
+	uncompressedData, err := eszipNoChunking.IntoBytes()
+	if err != nil {
+		t.Fatalf("failed to serialize uncompressed eszip: %v", err)
+	}
+	if len(data) >= len(uncompressedData) {
+		t.Errorf("expected chunked archive (%d bytes) to be smaller than unchunked (%d bytes)", len(data), len(uncompressedData))
+	}
+}
+
+// splitBeforeV2Sources returns the offset of the sources section within a
+// V2 archive serialized with default options (no checksum, no compression),
+// so a test can withhold everything from that point on to simulate a slow
+// reader without needing to re-derive the writer's internal layout.
+func splitBeforeV2Sources(t *testing.T, data []byte) int {
+	t.Helper()
+	off := 8 // magic
+	for i := 0; i < 3; i++ {
+		// options header, modules header, npm section: each is a plain
+		// u32 length prefix followed by that much content (no hash, since
+		// ChecksumNone has a zero-length digest).
+		if off+4 > len(data) {
+			t.Fatalf("archive too short to contain expected sections")
+		}
+		length := binary.BigEndian.Uint32(data[off : off+4])
+		off += 4 + int(length)
+	}
+	return off
+}
+
+func TestParseStreamIncrementalDelivery(t *testing.T) {
+	ctx := context.Background()
+
+	src := NewV2()
+	src.AddModule("file:///test.js", ModuleKindJavaScript, []byte("console.log('hi');"), nil)
+	data, err := src.IntoBytes()
+	if err != nil {
+		t.Fatalf("failed to serialize eszip: %v", err)
+	}
+	split := splitBeforeV2Sources(t, data)
+
+	pr, pw := io.Pipe()
+	release := make(chan struct{})
+	go func() {
+		pw.Write(data[:split])
+		<-release
+		pw.Write(data[split:])
+		pw.Close()
+	}()
+
+	_, modules, errs := ParseStream(ctx, pr)
+
+	var module *Module
+	select {
+	case module = <-modules:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for module metadata")
+	}
+	if module == nil || module.Specifier != "file:///test.js" {
+		t.Fatalf("unexpected module: %+v", module)
+	}
+
+	// Source bytes haven't been written yet, so this must still be blocked.
+	blockedCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := module.Source(blockedCtx); err != context.DeadlineExceeded {
+		t.Fatalf("expected Source to still be blocked, got err=%v", err)
+	}
+
+	close(release)
+
+	source, err := module.Source(ctx)
+	if err != nil {
+		t.Fatalf("failed to get source after release: %v", err)
+	}
+	if string(source) != "console.log('hi');" {
+		t.Errorf("expected source %q, got %q", "console.log('hi');", string(source))
+	}
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatalf("unexpected stream error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for completion")
+	}
+}
+
 func TestV1Iterator(t *testing.T) {
 	data, err := os.ReadFile("testdata/basic.json")
 	if err != nil {
@@ -412,3 +703,424 @@ func TestV2Iterator(t *testing.T) {
 		t.Errorf("expected at least 2 modules, got %d", len(modules))
 	}
 }
+
+func TestModuleMapAll(t *testing.T) {
+	eszip := NewV2()
+	eszip.AddModule("file:///a.js", ModuleKindJavaScript, []byte("a"), nil)
+	eszip.AddModule("file:///b.js", ModuleKindJavaScript, []byte("b"), nil)
+	eszip.AddModule("file:///c.js", ModuleKindJavaScript, []byte("c"), nil)
+
+	var seen []string
+	for specifier, mod := range eszip.modules.All() {
+		seen = append(seen, specifier)
+		if _, ok := mod.(*ModuleData); !ok {
+			t.Errorf("expected *ModuleData for %s", specifier)
+		}
+		if specifier == "file:///b.js" {
+			break
+		}
+	}
+	if want := []string{"file:///a.js", "file:///b.js"}; !slicesEqual(seen, want) {
+		t.Errorf("expected to stop after breaking at b.js, got %v", seen)
+	}
+
+	var keys []string
+	for key := range eszip.modules.KeysSeq() {
+		keys = append(keys, key)
+	}
+	if want := []string{"file:///a.js", "file:///b.js", "file:///c.js"}; !slicesEqual(keys, want) {
+		t.Errorf("expected keys %v, got %v", want, keys)
+	}
+}
+
+func TestEszipV1All(t *testing.T) {
+	eszip := &EszipV1{
+		Version: eszipV1GraphVersion,
+		parsedModules: map[string]*moduleInfoV1{
+			"file:///a.js": {source: &moduleSourceV1{Source: "a"}},
+			"file:///b.js": {source: &moduleSourceV1{Source: "b"}},
+		},
+	}
+
+	count := 0
+	for specifier, module := range eszip.All() {
+		if module == nil {
+			t.Errorf("expected non-nil module for %s", specifier)
+		}
+		count++
+	}
+	if count != 2 {
+		t.Errorf("expected 2 modules, got %d", count)
+	}
+}
+
+func slicesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestV2WriteAsTarRoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	eszip := NewV2()
+	eszip.AddModule("https://example.com/test.js", ModuleKindJavaScript, []byte("console.log('hello');"), []byte(`{"version":3}`))
+	eszip.AddRedirect("https://example.com/alias.js", "https://example.com/test.js")
+
+	var buf bytes.Buffer
+	if err := eszip.WriteAsTar(ctx, &buf); err != nil {
+		t.Fatalf("failed to write tar: %v", err)
+	}
+
+	parsed, err := FromTar(&buf)
+	if err != nil {
+		t.Fatalf("failed to read tar: %v", err)
+	}
+
+	module := parsed.GetModule("https://example.com/test.js")
+	if module == nil {
+		t.Fatal("expected to find module")
+	}
+	source, err := module.Source(ctx)
+	if err != nil {
+		t.Fatalf("failed to get source: %v", err)
+	}
+	if string(source) != "console.log('hello');" {
+		t.Errorf("expected source %q, got %q", "console.log('hello');", string(source))
+	}
+
+	alias := parsed.GetModule("https://example.com/alias.js")
+	if alias == nil {
+		t.Fatal("expected to find alias module via redirect")
+	}
+}
+
+func TestSanitizeSpecifierPathRejectsTraversal(t *testing.T) {
+	got := sanitizeSpecifierPath("file:///../../etc/cron.d/evil")
+	for _, seg := range strings.Split(got, "/") {
+		if seg == ".." || seg == "." {
+			t.Fatalf("sanitizeSpecifierPath(%q) = %q still contains a %q segment", "file:///../../etc/cron.d/evil", got, seg)
+		}
+	}
+}
+
+func TestV2WriteAsTarRejectsTraversal(t *testing.T) {
+	ctx := context.Background()
+
+	eszip := NewV2()
+	eszip.AddModule("file:///../../etc/cron.d/evil", ModuleKindJavaScript, []byte("malicious"), nil)
+
+	var buf bytes.Buffer
+	if err := eszip.WriteAsTar(ctx, &buf); err != nil {
+		t.Fatalf("failed to write tar: %v", err)
+	}
+
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read tar header: %v", err)
+		}
+		if strings.Contains(hdr.Name, "..") {
+			t.Errorf("tar entry %q escapes the archive root", hdr.Name)
+		}
+	}
+}
+
+func TestV2TarRoundTripChecksumStable(t *testing.T) {
+	ctx := context.Background()
+
+	eszip := NewV2()
+	eszip.AddModule("https://example.com/a.js", ModuleKindJavaScript, []byte("export const a = 1;"), []byte(`{"version":3}`))
+	eszip.AddModule("https://example.com/b.js", ModuleKindJavaScript, []byte("export const b = 2;"), nil)
+	eszip.AddRedirect("https://example.com/alias.js", "https://example.com/a.js")
+
+	before, err := eszip.IntoBytes()
+	if err != nil {
+		t.Fatalf("failed to serialize eszip: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := eszip.WriteAsTar(ctx, &buf); err != nil {
+		t.Fatalf("failed to write tar: %v", err)
+	}
+
+	reconstructed, err := FromTar(&buf)
+	if err != nil {
+		t.Fatalf("failed to read tar: %v", err)
+	}
+
+	after, err := reconstructed.IntoBytes()
+	if err != nil {
+		t.Fatalf("failed to serialize reconstructed eszip: %v", err)
+	}
+
+	beforeHash := sha256.Sum256(before)
+	afterHash := sha256.Sum256(after)
+	if beforeHash != afterHash {
+		t.Errorf("expected eszip -> tar -> eszip round trip to produce identical bytes, checksums differ")
+	}
+}
+
+func TestV2WriteAsZipRoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	eszip := NewV2()
+	eszip.AddModule("https://example.com/test.js", ModuleKindJavaScript, []byte("console.log('hello');"), nil)
+
+	var buf bytes.Buffer
+	if err := eszip.WriteAsZip(ctx, &buf); err != nil {
+		t.Fatalf("failed to write zip: %v", err)
+	}
+
+	parsed, err := FromZip(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("failed to read zip: %v", err)
+	}
+
+	module := parsed.GetModule("https://example.com/test.js")
+	if module == nil {
+		t.Fatal("expected to find module")
+	}
+	source, err := module.Source(ctx)
+	if err != nil {
+		t.Fatalf("failed to get source: %v", err)
+	}
+	if string(source) != "console.log('hello');" {
+		t.Errorf("expected source %q, got %q", "console.log('hello');", string(source))
+	}
+}
+
+func TestV2DedupeRoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	blobs := [][]byte{
+		bytes.Repeat([]byte("a"), 10000),
+		bytes.Repeat([]byte("b"), 10000),
+		bytes.Repeat([]byte("c"), 10000),
+	}
+
+	eszip := NewV2WithOptions(BuildOptions{Dedupe: true, DedupeHash: ChecksumXxh3})
+	for i := 0; i < 100; i++ {
+		specifier := fmt.Sprintf("file:///mod%d.js", i)
+		eszip.AddModule(specifier, ModuleKindJavaScript, blobs[i%3], nil)
+	}
+
+	data, err := eszip.IntoBytes()
+	if err != nil {
+		t.Fatalf("failed to serialize eszip: %v", err)
+	}
+
+	// With dedup, the sources section should hold roughly 3 copies of the
+	// blob, not 100.
+	eszipNoDedupe := NewV2()
+	for i := 0; i < 100; i++ {
+		specifier := fmt.Sprintf("file:///mod%d.js", i)
+		eszipNoDedupe.AddModule(specifier, ModuleKindJavaScript, blobs[i%3], nil)
+	}
+	uncompressedData, err := eszipNoDedupe.IntoBytes()
+	if err != nil {
+		t.Fatalf("failed to serialize non-dedup eszip: %v", err)
+	}
+
+	if len(data) >= len(uncompressedData)/10 {
+		t.Errorf("expected deduped archive (%d bytes) to be proportional to 3 copies, not 100 (undeduped: %d bytes)", len(data), len(uncompressedData))
+	}
+
+	parsed, err := ParseBytes(ctx, data)
+	if err != nil {
+		t.Fatalf("failed to parse serialized eszip: %v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		specifier := fmt.Sprintf("file:///mod%d.js", i)
+		module := parsed.GetModule(specifier)
+		if module == nil {
+			t.Fatalf("expected to find module %s", specifier)
+		}
+		source, err := module.Source(ctx)
+		if err != nil {
+			t.Fatalf("failed to get source for %s: %v", specifier, err)
+		}
+		if !bytes.Equal(source, blobs[i%3]) {
+			t.Errorf("source mismatch for %s", specifier)
+		}
+	}
+}
+
+func TestV2NpmDependencyKindsRoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	appID := &NpmPackageID{Name: "app", Version: "1.0.0"}
+	reactID := &NpmPackageID{Name: "react", Version: "18.0.0"}
+	fseventsID := &NpmPackageID{Name: "fsevents", Version: "2.3.2"}
+	typesNodeID := &NpmPackageID{Name: "@types/node", Version: "20.0.0"}
+
+	eszip := NewV2()
+	eszip.npmSnapshot = &NpmResolutionSnapshot{
+		Packages: []*NpmPackage{
+			{
+				ID:           appID,
+				Dependencies: map[string]*NpmPackageID{"react": reactID},
+				PeerDependencies: map[string]*NpmPackageID{
+					"react-dom": reactID,
+				},
+				OptionalDependencies: map[string]*NpmPackageID{
+					"fsevents": fseventsID,
+				},
+				OptionalPeerDependencies: map[string]*NpmPackageID{
+					"@types/node": typesNodeID,
+				},
+			},
+			{ID: reactID, Dependencies: map[string]*NpmPackageID{}},
+			{ID: fseventsID, Dependencies: map[string]*NpmPackageID{}},
+			{ID: typesNodeID, Dependencies: map[string]*NpmPackageID{}},
+		},
+		RootPackages: map[string]*NpmPackageID{"app": appID},
+	}
+
+	data, err := eszip.IntoBytes()
+	if err != nil {
+		t.Fatalf("failed to serialize eszip: %v", err)
+	}
+
+	parsed, err := ParseBytes(ctx, data)
+	if err != nil {
+		t.Fatalf("failed to parse serialized eszip: %v", err)
+	}
+
+	snapshot := parsed.TakeNpmSnapshot()
+	if snapshot == nil {
+		t.Fatalf("expected an npm snapshot")
+	}
+
+	var app *NpmPackage
+	for _, pkg := range snapshot.Packages {
+		if pkg.ID.String() == appID.String() {
+			app = pkg
+		}
+	}
+	if app == nil {
+		t.Fatalf("expected to find package %s", appID.String())
+	}
+
+	if id, ok := app.Dependencies["react"]; !ok || id.String() != reactID.String() {
+		t.Errorf("expected regular dependency on react, got %v", app.Dependencies)
+	}
+	if id, ok := app.PeerDependencies["react-dom"]; !ok || id.String() != reactID.String() {
+		t.Errorf("expected peer dependency on react-dom, got %v", app.PeerDependencies)
+	}
+	if id, ok := app.OptionalDependencies["fsevents"]; !ok || id.String() != fseventsID.String() {
+		t.Errorf("expected optional dependency on fsevents, got %v", app.OptionalDependencies)
+	}
+	if id, ok := app.OptionalPeerDependencies["@types/node"]; !ok || id.String() != typesNodeID.String() {
+		t.Errorf("expected optional-peer dependency on @types/node, got %v", app.OptionalPeerDependencies)
+	}
+}
+
+func TestV2NpmDependenciesWithoutKindsStayUntagged(t *testing.T) {
+	ctx := context.Background()
+
+	appID := &NpmPackageID{Name: "app", Version: "1.0.0"}
+	reactID := &NpmPackageID{Name: "react", Version: "18.0.0"}
+
+	eszip := NewV2()
+	eszip.npmSnapshot = &NpmResolutionSnapshot{
+		Packages: []*NpmPackage{
+			{ID: appID, Dependencies: map[string]*NpmPackageID{"react": reactID}},
+			{ID: reactID, Dependencies: map[string]*NpmPackageID{}},
+		},
+		RootPackages: map[string]*NpmPackageID{"app": appID},
+	}
+
+	data, err := eszip.IntoBytes()
+	if err != nil {
+		t.Fatalf("failed to serialize eszip: %v", err)
+	}
+
+	parsed, err := ParseBytes(ctx, data)
+	if err != nil {
+		t.Fatalf("failed to parse serialized eszip: %v", err)
+	}
+
+	snapshot := parsed.TakeNpmSnapshot()
+	if snapshot == nil {
+		t.Fatalf("expected an npm snapshot")
+	}
+	for _, pkg := range snapshot.Packages {
+		if pkg.ID.String() == appID.String() {
+			if id, ok := pkg.Dependencies["react"]; !ok || id.String() != reactID.String() {
+				t.Errorf("expected regular dependency on react, got %v", pkg.Dependencies)
+			}
+		}
+	}
+}
+
+func TestModuleDataSourceHashAndDedupStats(t *testing.T) {
+	ctx := context.Background()
+
+	shared := []byte("export const x = 1;\n")
+	other := []byte("export const y = 2;\n")
+
+	eszip := NewV2()
+	eszip.AddModule("file:///a.js", ModuleKindJavaScript, shared, nil)
+	eszip.AddModule("file:///b.js", ModuleKindJavaScript, shared, nil)
+	eszip.AddModule("file:///c.js", ModuleKindJavaScript, other, nil)
+
+	wantHash := sha256.Sum256(shared)
+	modA, ok := eszip.modules.Get("file:///a.js")
+	if !ok {
+		t.Fatalf("expected to find module a.js")
+	}
+	if dataA, ok := modA.(*ModuleData); !ok || dataA.SourceHash != wantHash {
+		t.Errorf("expected AddModule to set SourceHash to sha256 of the source")
+	}
+
+	duplicateModules, bytesSaved, err := eszip.modules.DedupStats(ctx)
+	if err != nil {
+		t.Fatalf("DedupStats failed: %v", err)
+	}
+	if duplicateModules != 1 {
+		t.Errorf("expected 1 duplicate module, got %d", duplicateModules)
+	}
+	if wantBytes := int64(len(shared)); bytesSaved != wantBytes {
+		t.Errorf("expected %d bytes saved, got %d", wantBytes, bytesSaved)
+	}
+
+	data, err := eszip.IntoBytes()
+	if err != nil {
+		t.Fatalf("failed to serialize eszip: %v", err)
+	}
+
+	parsed, err := ParseBytes(ctx, data)
+	if err != nil {
+		t.Fatalf("failed to parse serialized eszip: %v", err)
+	}
+
+	module := parsed.GetModule("file:///b.js")
+	if module == nil {
+		t.Fatalf("expected to find module b.js")
+	}
+	if _, err := module.Source(ctx); err != nil {
+		t.Fatalf("failed to get source for b.js: %v", err)
+	}
+
+	parsedV2 := parsed.V2()
+	modB, ok := parsedV2.modules.Get("file:///b.js")
+	if !ok {
+		t.Fatalf("expected to find module b.js")
+	}
+	dataB, ok := modB.(*ModuleData)
+	if !ok || dataB.SourceHash != wantHash {
+		t.Errorf("expected parsed module to have SourceHash set after loading")
+	}
+}
@@ -4,6 +4,7 @@ package eszip
 
 import (
 	"context"
+	"io"
 	"sync"
 )
 
@@ -40,6 +41,12 @@ type Module struct {
 	Specifier string
 	Kind      ModuleKind
 	inner     moduleInner
+
+	// RequestedSpecifier is the specifier originally passed to
+	// GetModule/GetImportMap, before following any redirects. It differs
+	// from Specifier whenever the requested specifier resolved through one
+	// or more ModuleRedirect entries to reach this module.
+	RequestedSpecifier string
 }
 
 // moduleInner provides access to module sources
@@ -78,6 +85,18 @@ const (
 	SourceSlotPending SourceSlotState = iota
 	SourceSlotReady
 	SourceSlotTaken
+	// SourceSlotMapped is a slot backed directly by a sub-slice of a
+	// memory-mapped file (see NewMappedSourceSlot / ParseFile). It resolves
+	// to SourceSlotReady on first Get/Take, same as a lazy slot, except
+	// that for an uncompressed archive the content bytes are never copied
+	// out of the mapping by Get -- only Take copies them, so they can
+	// outlive the mapping's Close. A compressed archive always decompresses
+	// into a fresh buffer on first Get/Take regardless.
+	SourceSlotMapped
+	// SourceSlotInvalid is a terminal state for a slot that's known to be
+	// unresolvable (see NewInvalidSourceSlot); Get/Take return its stored
+	// error immediately.
+	SourceSlotInvalid
 )
 
 // SourceSlot represents a pending or loaded source
@@ -88,6 +107,25 @@ type SourceSlot struct {
 	offset uint32
 	length uint32
 	waitCh chan struct{}
+
+	// Lazy-loading support (see NewLazySourceSlot). When pendingReader is
+	// set, the slot resolves its data on first Get/Take instead of waiting
+	// for a streaming SetReady call. pendingHash covers the trailing
+	// checksum hash and is read lazily alongside pendingReader, so building
+	// a lazy slot never has to touch the archive up front.
+	pendingReader *io.SectionReader
+	pendingHash   *io.SectionReader
+	checksum      ChecksumType
+	compression   CompressionType
+	loadOnce      sync.Once
+	loadErr       error
+
+	// Mapped-slot support (see NewMappedSourceSlot). mappedContent and
+	// mappedHash are sub-slices of the memory mapping owned by the
+	// MappedEszip that created this slot; they must not be read after that
+	// mapping's Close has been called.
+	mappedContent []byte
+	mappedHash    []byte
 }
 
 // NewPendingSourceSlot creates a new pending source slot
@@ -116,6 +154,61 @@ func NewEmptySourceSlot() *SourceSlot {
 	return NewReadySourceSlot([]byte{})
 }
 
+// NewLazySourceSlot creates a pending slot that resolves its data on first
+// access by reading its content from r and its checksum hash from
+// hashReader, rather than waiting for a streaming SetReady call. Neither
+// reader is touched until then, so constructing a lazy slot never reads the
+// archive. hashReader may be a zero-length section if options.Checksum is
+// ChecksumNone.
+func NewLazySourceSlot(r *io.SectionReader, checksum ChecksumType, compression CompressionType, hashReader *io.SectionReader, offset, length uint32) *SourceSlot {
+	return &SourceSlot{
+		state:         SourceSlotPending,
+		offset:        offset,
+		length:        length,
+		waitCh:        make(chan struct{}),
+		pendingReader: r,
+		pendingHash:   hashReader,
+		checksum:      checksum,
+		compression:   compression,
+	}
+}
+
+// NewInvalidSourceSlot creates a slot that immediately fails every Get/Take
+// with err. It's used when a slot's offsets turn out to be invalid only
+// once the module is actually decoded -- e.g. a lazily-parsed archive whose
+// per-module wiring (see ModuleMap.OnDecode) runs after the section that
+// would normally catch this at parse time has already been read.
+func NewInvalidSourceSlot(err error) *SourceSlot {
+	ch := make(chan struct{})
+	close(ch)
+	return &SourceSlot{
+		state:   SourceSlotInvalid,
+		waitCh:  ch,
+		loadErr: err,
+	}
+}
+
+// NewMappedSourceSlot creates a pending slot whose content and hash are
+// sub-slices of a memory-mapped file, rather than copies read off an
+// io.ReaderAt. Verification and decompression are still deferred to the
+// first Get/Take call (see loadMapped), at which point the slot behaves
+// like any other slot -- the zero-copy win is that, for an uncompressed
+// archive, Get never allocates: it hands back the mapped bytes directly.
+// That also means a Get result from an uncompressed archive does not
+// outlive the owning MappedEszip's Close; only Take's result does.
+func NewMappedSourceSlot(content, hash []byte, checksum ChecksumType, compression CompressionType, offset, length uint32) *SourceSlot {
+	return &SourceSlot{
+		state:         SourceSlotMapped,
+		offset:        offset,
+		length:        length,
+		waitCh:        make(chan struct{}),
+		checksum:      checksum,
+		compression:   compression,
+		mappedContent: content,
+		mappedHash:    hash,
+	}
+}
+
 // SetReady marks the slot as ready with the given data
 func (s *SourceSlot) SetReady(data []byte) {
 	s.mu.Lock()
@@ -125,8 +218,109 @@ func (s *SourceSlot) SetReady(data []byte) {
 	close(s.waitCh)
 }
 
+// loadLazy reads and verifies the pending reader exactly once, transitioning
+// the slot to SourceSlotReady (or recording loadErr on failure).
+func (s *SourceSlot) loadLazy() {
+	s.loadOnce.Do(func() {
+		s.mu.RLock()
+		r := s.pendingReader
+		hashReader := s.pendingHash
+		checksum := s.checksum
+		compression := s.compression
+		s.mu.RUnlock()
+		if r == nil {
+			return
+		}
+
+		content := make([]byte, s.length)
+		if _, err := io.ReadFull(r, content); err != nil {
+			s.loadErr = errIO(err)
+			return
+		}
+
+		var expectedHash []byte
+		if hashReader != nil && hashReader.Size() > 0 {
+			expectedHash = make([]byte, hashReader.Size())
+			if _, err := io.ReadFull(hashReader, expectedHash); err != nil {
+				s.loadErr = errIO(err)
+				return
+			}
+		}
+
+		if !checksum.Verify(content, expectedHash) {
+			s.loadErr = errInvalidV2SourceHash("")
+			return
+		}
+
+		content, err := compression.Decompress(content)
+		if err != nil {
+			s.loadErr = err
+			return
+		}
+
+		s.mu.Lock()
+		s.data = content
+		s.state = SourceSlotReady
+		close(s.waitCh)
+		s.mu.Unlock()
+	})
+}
+
+// loadMapped verifies and (if needed) decompresses a mapped slot's content
+// exactly once. Unlike loadLazy, it never copies the content out of the
+// mapping when the archive is uncompressed -- compression.Decompress is a
+// no-op pass-through for CompressionNone.
+func (s *SourceSlot) loadMapped() {
+	s.loadOnce.Do(func() {
+		s.mu.RLock()
+		content := s.mappedContent
+		hash := s.mappedHash
+		checksum := s.checksum
+		compression := s.compression
+		s.mu.RUnlock()
+
+		if !checksum.Verify(content, hash) {
+			s.loadErr = errInvalidV2SourceHash("")
+			return
+		}
+
+		decoded, err := compression.Decompress(content)
+		if err != nil {
+			s.loadErr = err
+			return
+		}
+
+		s.mu.Lock()
+		s.data = decoded
+		s.state = SourceSlotReady
+		close(s.waitCh)
+		s.mu.Unlock()
+	})
+}
+
 // Get returns the source data, blocking until ready or context cancelled
 func (s *SourceSlot) Get(ctx context.Context) ([]byte, error) {
+	s.mu.RLock()
+	isPendingLazy := s.state == SourceSlotPending && s.pendingReader != nil
+	isMapped := s.state == SourceSlotMapped
+	isInvalid := s.state == SourceSlotInvalid
+	s.mu.RUnlock()
+	if isInvalid {
+		return nil, s.loadErr
+	}
+	if isPendingLazy {
+		s.loadLazy()
+		if s.loadErr != nil {
+			return nil, s.loadErr
+		}
+	}
+	if isMapped {
+		s.loadMapped()
+		if s.loadErr != nil {
+			return nil, s.loadErr
+		}
+	}
+
 	s.mu.RLock()
 	if s.state == SourceSlotReady {
 		data := s.data
@@ -155,6 +349,27 @@ func (s *SourceSlot) Get(ctx context.Context) ([]byte, error) {
 
 // Take returns and removes the source data
 func (s *SourceSlot) Take(ctx context.Context) ([]byte, error) {
+	s.mu.RLock()
+	isPendingLazy := s.state == SourceSlotPending && s.pendingReader != nil
+	isMapped := s.state == SourceSlotMapped
+	isInvalid := s.state == SourceSlotInvalid
+	s.mu.RUnlock()
+	if isInvalid {
+		return nil, s.loadErr
+	}
+	if isPendingLazy {
+		s.loadLazy()
+		if s.loadErr != nil {
+			return nil, s.loadErr
+		}
+	}
+	if isMapped {
+		s.loadMapped()
+		if s.loadErr != nil {
+			return nil, s.loadErr
+		}
+	}
+
 	s.mu.RLock()
 	if s.state == SourceSlotTaken {
 		s.mu.RUnlock()
@@ -178,7 +393,14 @@ func (s *SourceSlot) Take(ctx context.Context) ([]byte, error) {
 		return nil, nil
 	}
 	data := s.data
+	if s.mappedContent != nil {
+		// Copy out of the mapping so the caller's data outlives a later
+		// MappedEszip.Close.
+		data = append([]byte(nil), data...)
+	}
 	s.data = nil
+	s.mappedContent = nil
+	s.mappedHash = nil
 	s.state = SourceSlotTaken
 	return data, nil
 }
@@ -3,6 +3,9 @@
 package eszip
 
 import (
+	"context"
+	"crypto/sha256"
+	"iter"
 	"sync"
 )
 
@@ -11,6 +14,18 @@ type ModuleMap struct {
 	mu    sync.RWMutex
 	order []string
 	data  map[string]EszipV2Module
+
+	// lazyIndex, when non-nil, backs every specifier in order that isn't
+	// yet in data: Get binary-searches idx and decodes just that one entry
+	// on first access instead of requiring parseModulesHeaderV3 to decode
+	// every entry up front. See prepareLazy and registerLazy.
+	lazyIndex               *ModulesIndex
+	lazySupportsNpm         bool
+	lazySupportsCompression bool
+
+	// onDecode holds callbacks registered via OnDecode, run once per
+	// ModuleData at the moment it's decoded -- see OnDecode.
+	onDecode []func(specifier string, data *ModuleData)
 }
 
 // EszipV2Module represents a module entry in V2 format
@@ -23,6 +38,24 @@ type ModuleData struct {
 	Kind      ModuleKind
 	Source    *SourceSlot
 	SourceMap *SourceSlot
+
+	// UncompressedSourceLen and UncompressedSourceMapLen record the
+	// original byte length of Source/SourceMap before compression (see
+	// Options.Compression). They are 0 when the archive was written
+	// without compression, and informational only: decompression itself
+	// does not depend on them.
+	UncompressedSourceLen    uint32
+	UncompressedSourceMapLen uint32
+
+	// SourceHash is the SHA-256 of Source's decoded bytes, set by AddModule
+	// and by the parser once a (possibly dedup-shared, see
+	// BuildOptions.Dedupe) source section entry has loaded. It's zero for a
+	// module whose source hasn't been loaded by that parser, including every
+	// module of a lazy/mapped archive (ParseV2Lazy, ParseFile), whose slots
+	// don't set it even after their first Get/Take. It is never consulted
+	// by Source/TakeSource themselves -- it's purely informational, for tooling like
+	// ModuleMap.DedupStats to find modules sharing identical content.
+	SourceHash [32]byte
 }
 
 func (ModuleData) isEszipV2Module() {}
@@ -76,21 +109,100 @@ func (m *ModuleMap) InsertFront(specifier string, module EszipV2Module) {
 	m.data[specifier] = module
 }
 
-// Get retrieves a module
+// Get retrieves a module, decoding it from the lazy index (see prepareLazy)
+// on first access if it hasn't been resolved yet.
 func (m *ModuleMap) Get(specifier string) (EszipV2Module, bool) {
 	m.mu.RLock()
-	defer m.mu.RUnlock()
 	mod, ok := m.data[specifier]
-	return mod, ok
+	idx := m.lazyIndex
+	supportsNpm := m.lazySupportsNpm
+	supportsCompression := m.lazySupportsCompression
+	m.mu.RUnlock()
+	if ok || idx == nil {
+		return mod, ok
+	}
+
+	decoded, npmIdx, found, err := idx.Get(specifier, supportsNpm, supportsCompression)
+	if err != nil || !found || npmIdx != nil {
+		return nil, false
+	}
+
+	m.mu.Lock()
+	if existing, ok := m.data[specifier]; ok {
+		m.mu.Unlock()
+		return existing, true
+	}
+	m.data[specifier] = decoded
+	hooks := m.onDecode
+	m.mu.Unlock()
+
+	if data, ok := decoded.(*ModuleData); ok {
+		for _, fn := range hooks {
+			fn(specifier, data)
+		}
+	}
+	return decoded, true
 }
 
-// GetMut retrieves a module for mutation (returns the pointer)
+// GetMut retrieves a module for mutation (returns the pointer), decoding it
+// from the lazy index first if needed -- see Get.
 func (m *ModuleMap) GetMut(specifier string) EszipV2Module {
+	if mod, ok := m.Get(specifier); ok {
+		return mod
+	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	return m.data[specifier]
 }
 
+// prepareLazy backs this map with idx, so that Get and GetMut decode
+// specifiers registered via registerLazy from it on demand. It must be
+// called before any call to registerLazy.
+func (m *ModuleMap) prepareLazy(idx *ModulesIndex, supportsNpm, supportsCompression bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lazyIndex = idx
+	m.lazySupportsNpm = supportsNpm
+	m.lazySupportsCompression = supportsCompression
+}
+
+// registerLazy records specifier in iteration order without decoding its
+// entry. It's the lazy counterpart to Insert, used by parseModulesHeaderV3
+// once prepareLazy has pointed this map at the index those entries live in.
+func (m *ModuleMap) registerLazy(specifier string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.order = append(m.order, specifier)
+}
+
+// OnDecode registers fn to run exactly once per ModuleData, at the moment
+// that module is decoded: immediately (synchronously, before OnDecode
+// returns) for every specifier already in data, and from within Get the
+// first time it decodes a specifier that was only registered via
+// registerLazy. fn is never called for redirects or npm specifiers.
+//
+// attachLazySources and attachMappedSources use this to wire up source
+// slots without forcing every lazily-registered specifier to decode up
+// front just to inspect its (still-pending) slot -- a module registered via
+// registerLazy and never looked up never runs fn at all.
+func (m *ModuleMap) OnDecode(fn func(specifier string, data *ModuleData)) {
+	m.mu.Lock()
+	var alreadyDecoded []ModuleEntry
+	for _, specifier := range m.order {
+		if mod, ok := m.data[specifier]; ok {
+			alreadyDecoded = append(alreadyDecoded, ModuleEntry{Specifier: specifier, Module: mod})
+		}
+	}
+	m.onDecode = append(m.onDecode, fn)
+	m.mu.Unlock()
+
+	for _, entry := range alreadyDecoded {
+		if data, ok := entry.Module.(*ModuleData); ok {
+			fn(entry.Specifier, data)
+		}
+	}
+}
+
 // Remove removes a module and returns it
 func (m *ModuleMap) Remove(specifier string) (EszipV2Module, bool) {
 	m.mu.Lock()
@@ -130,23 +242,99 @@ type ModuleEntry struct {
 	Module    EszipV2Module
 }
 
-// Iterate returns a channel that yields all modules
+// All returns an iterator over every specifier/module pair, in insertion
+// order. Unlike Iterate, breaking out of the range loop early leaves
+// nothing running in the background.
+func (m *ModuleMap) All() iter.Seq2[string, EszipV2Module] {
+	return func(yield func(string, EszipV2Module) bool) {
+		for _, key := range m.Keys() {
+			mod, ok := m.Get(key)
+			if !ok {
+				continue
+			}
+			if !yield(key, mod) {
+				return
+			}
+		}
+	}
+}
+
+// KeysSeq returns an iterator over every specifier, in insertion order.
+// It's named distinctly from Keys (which returns a []string snapshot and
+// already has callers throughout this package that rely on that) rather
+// than overloading the name, since Go doesn't allow two methods of the same
+// name with different signatures.
+func (m *ModuleMap) KeysSeq() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for _, key := range m.Keys() {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+// DedupStats resolves every ModuleData's source in this map and reports how
+// much content-addressed deduplication could save: how many modules hold
+// source content that's a byte-for-byte duplicate of another module's
+// (duplicateModules), and the total duplicate byte count that implies
+// (bytesSaved). It's meant for offline tooling, not the hot path -- it
+// forces lazy and memory-mapped sources to load.
+func (m *ModuleMap) DedupStats(ctx context.Context) (duplicateModules int, bytesSaved int64, err error) {
+	type group struct {
+		count int
+		size  int64
+	}
+	groups := make(map[[32]byte]*group)
+
+	for _, key := range m.Keys() {
+		mod, ok := m.Get(key)
+		if !ok {
+			continue
+		}
+		data, ok := mod.(*ModuleData)
+		if !ok {
+			continue
+		}
+
+		content, err := data.Source.Get(ctx)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		hash := data.SourceHash
+		var zero [32]byte
+		if hash == zero {
+			hash = sha256.Sum256(content)
+		}
+
+		g, exists := groups[hash]
+		if !exists {
+			g = &group{size: int64(len(content))}
+			groups[hash] = g
+		}
+		g.count++
+	}
+
+	for _, g := range groups {
+		if g.count > 1 {
+			duplicateModules += g.count - 1
+			bytesSaved += int64(g.count-1) * g.size
+		}
+	}
+	return duplicateModules, bytesSaved, nil
+}
+
+// Iterate returns a channel that yields all modules.
+//
+// Deprecated: range over All instead; unlike this method, it doesn't leak a
+// goroutine when the consumer breaks out of the loop early.
 func (m *ModuleMap) Iterate() <-chan ModuleEntry {
 	ch := make(chan ModuleEntry)
 	go func() {
 		defer close(ch)
-		m.mu.RLock()
-		keys := make([]string, len(m.order))
-		copy(keys, m.order)
-		m.mu.RUnlock()
-
-		for _, key := range keys {
-			m.mu.RLock()
-			mod, ok := m.data[key]
-			m.mu.RUnlock()
-			if ok {
-				ch <- ModuleEntry{Specifier: key, Module: mod}
-			}
+		for key, mod := range m.All() {
+			ch <- ModuleEntry{Specifier: key, Module: mod}
 		}
 	}()
 	return ch
@@ -0,0 +1,280 @@
+// Copyright 2018-2024 the Deno authors. All rights reserved. MIT license.
+
+package eszip
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zeebo/xxh3"
+)
+
+// ReleaseManifestFormatVersion is the Format-Version field written into
+// every manifest produced by BuildReleaseManifest. Bump it if the text
+// layout below ever changes incompatibly.
+const ReleaseManifestFormatVersion = 1
+
+// ReleaseDigests holds the four digests a ReleaseManifest records for a
+// module or for the archive file as a whole. These are plain content
+// hashes, computed independently of the archive's own ChecksumType, so a
+// mirror or CDN can validate a module without parsing the eszip binary
+// format at all.
+type ReleaseDigests struct {
+	MD5    string
+	SHA1   string
+	SHA256 string
+	XXH3   string
+}
+
+func digestsOf(data []byte) ReleaseDigests {
+	md5Sum := md5.Sum(data)
+	sha1Sum := sha1.Sum(data)
+	sha256Sum := sha256.Sum256(data)
+
+	return ReleaseDigests{
+		MD5:    hex.EncodeToString(md5Sum[:]),
+		SHA1:   hex.EncodeToString(sha1Sum[:]),
+		SHA256: hex.EncodeToString(sha256Sum[:]),
+		XXH3:   fmt.Sprintf("%016x", xxh3.Hash(data)),
+	}
+}
+
+// ReleaseModuleEntry is one module's row in a ReleaseManifest.
+type ReleaseModuleEntry struct {
+	Specifier string
+	Size      uint64
+	Digests   ReleaseDigests
+}
+
+// ReleaseManifest is a standalone, human-readable index of an eszip
+// archive's contents, modeled on a Debian Release/Packages index: every
+// module specifier alongside its size and digests under several
+// algorithms, plus the same for the archive file itself. It lets a
+// downstream mirror or CDN validate individual modules, or a supply-chain
+// audit confirm exactly what sources an archive claims to contain, without
+// parsing the eszip binary format.
+type ReleaseManifest struct {
+	FormatVersion int
+	CreatedAt     time.Time
+	ArchiveSize   uint64
+	Archive       ReleaseDigests
+	Modules       []ReleaseModuleEntry
+}
+
+// BuildReleaseManifest computes a ReleaseManifest for data, an
+// already-serialized eszip archive, and union, the same archive parsed.
+// The two must describe the same bytes; callers typically get union by
+// reparsing data right after writing it, the same way createCmd does for
+// -cas.
+func BuildReleaseManifest(ctx context.Context, data []byte, union *EszipUnion) (*ReleaseManifest, error) {
+	manifest := &ReleaseManifest{
+		FormatVersion: ReleaseManifestFormatVersion,
+		CreatedAt:     time.Now().UTC(),
+		ArchiveSize:   uint64(len(data)),
+		Archive:       digestsOf(data),
+	}
+
+	for _, spec := range union.Specifiers() {
+		module := union.GetModule(spec)
+		if module == nil {
+			continue // Redirect or npm specifier; nothing to digest.
+		}
+		source, err := module.Source(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("eszip: failed to read source for %s: %w", spec, err)
+		}
+		manifest.Modules = append(manifest.Modules, ReleaseModuleEntry{
+			Specifier: spec,
+			Size:      uint64(len(source)),
+			Digests:   digestsOf(source),
+		})
+	}
+
+	sort.Slice(manifest.Modules, func(i, j int) bool {
+		return manifest.Modules[i].Specifier < manifest.Modules[j].Specifier
+	})
+
+	return manifest, nil
+}
+
+// releaseDigestSections pairs each digest algorithm's manifest section
+// name with the accessor used to read and write it, so Encode and
+// ParseReleaseManifest don't have to repeat themselves per algorithm.
+var releaseDigestSections = []struct {
+	header string
+	get    func(*ReleaseDigests) *string
+}{
+	{"MD5Sum", func(d *ReleaseDigests) *string { return &d.MD5 }},
+	{"SHA1", func(d *ReleaseDigests) *string { return &d.SHA1 }},
+	{"SHA256", func(d *ReleaseDigests) *string { return &d.SHA256 }},
+	{"XXH3", func(d *ReleaseDigests) *string { return &d.XXH3 }},
+}
+
+// Encode renders the manifest as Debian-Release-style text: a small
+// key/value header followed by one section per digest algorithm, each
+// listing "<hex digest>  <size>  <specifier>" for every module.
+func (m *ReleaseManifest) Encode() []byte {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "Format-Version: %d\n", m.FormatVersion)
+	fmt.Fprintf(&buf, "Created: %s\n", m.CreatedAt.Format(time.RFC3339))
+	fmt.Fprintf(&buf, "Archive-Size: %d\n", m.ArchiveSize)
+	fmt.Fprintf(&buf, "Archive-MD5: %s\n", m.Archive.MD5)
+	fmt.Fprintf(&buf, "Archive-SHA1: %s\n", m.Archive.SHA1)
+	fmt.Fprintf(&buf, "Archive-SHA256: %s\n", m.Archive.SHA256)
+	fmt.Fprintf(&buf, "Archive-XXH3: %s\n", m.Archive.XXH3)
+	buf.WriteByte('\n')
+
+	for _, section := range releaseDigestSections {
+		fmt.Fprintf(&buf, "%s:\n", section.header)
+		for _, mod := range m.Modules {
+			digests := mod.Digests
+			fmt.Fprintf(&buf, " %s  %d  %s\n", *section.get(&digests), mod.Size, mod.Specifier)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// ParseReleaseManifest parses a manifest produced by Encode.
+func ParseReleaseManifest(data []byte) (*ReleaseManifest, error) {
+	manifest := &ReleaseManifest{}
+
+	entries := make(map[string]*ReleaseModuleEntry)
+	var order []string
+	entry := func(spec string) *ReleaseModuleEntry {
+		if e, ok := entries[spec]; ok {
+			return e
+		}
+		e := &ReleaseModuleEntry{Specifier: spec}
+		entries[spec] = e
+		order = append(order, spec)
+		return e
+	}
+
+	var section string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			continue
+
+		case strings.HasPrefix(line, " "):
+			fields := strings.Fields(line)
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("eszip: malformed manifest line %q", line)
+			}
+			digest, sizeStr, spec := fields[0], fields[1], fields[2]
+			size, err := strconv.ParseUint(sizeStr, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("eszip: malformed size in manifest line %q: %w", line, err)
+			}
+			e := entry(spec)
+			e.Size = size
+			for _, s := range releaseDigestSections {
+				if s.header == section {
+					*s.get(&e.Digests) = digest
+				}
+			}
+
+		case strings.HasSuffix(line, ":"):
+			section = strings.TrimSuffix(line, ":")
+
+		default:
+			key, value, ok := strings.Cut(line, ": ")
+			if !ok {
+				continue
+			}
+			var err error
+			switch key {
+			case "Format-Version":
+				manifest.FormatVersion, err = strconv.Atoi(value)
+			case "Created":
+				manifest.CreatedAt, err = time.Parse(time.RFC3339, value)
+			case "Archive-Size":
+				manifest.ArchiveSize, err = strconv.ParseUint(value, 10, 64)
+			case "Archive-MD5":
+				manifest.Archive.MD5 = value
+			case "Archive-SHA1":
+				manifest.Archive.SHA1 = value
+			case "Archive-SHA256":
+				manifest.Archive.SHA256 = value
+			case "Archive-XXH3":
+				manifest.Archive.XXH3 = value
+			}
+			if err != nil {
+				return nil, fmt.Errorf("eszip: malformed manifest header %q: %w", line, err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errIO(err)
+	}
+
+	for _, spec := range order {
+		manifest.Modules = append(manifest.Modules, *entries[spec])
+	}
+
+	return manifest, nil
+}
+
+// ReleaseMismatch describes one manifest entry whose recomputed digest
+// didn't match what the manifest claims, or that isn't present on both
+// sides at all.
+type ReleaseMismatch struct {
+	Specifier string
+	Reason    string
+}
+
+// Verify recomputes every digest in m against archive, and -- if data is
+// non-nil -- the archive file's own digests, reporting every mismatch. A
+// nil result means archive matches m exactly.
+func (m *ReleaseManifest) Verify(ctx context.Context, data []byte, archive *EszipUnion) ([]ReleaseMismatch, error) {
+	var mismatches []ReleaseMismatch
+
+	if data != nil && digestsOf(data) != m.Archive {
+		mismatches = append(mismatches, ReleaseMismatch{Specifier: "(archive)", Reason: "archive file digest mismatch"})
+	}
+
+	seen := make(map[string]bool, len(m.Modules))
+	for _, want := range m.Modules {
+		seen[want.Specifier] = true
+
+		module := archive.GetModule(want.Specifier)
+		if module == nil {
+			mismatches = append(mismatches, ReleaseMismatch{Specifier: want.Specifier, Reason: "listed in manifest but not found in archive"})
+			continue
+		}
+
+		source, err := module.Source(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("eszip: failed to read source for %s: %w", want.Specifier, err)
+		}
+		if uint64(len(source)) != want.Size || digestsOf(source) != want.Digests {
+			mismatches = append(mismatches, ReleaseMismatch{Specifier: want.Specifier, Reason: "digest mismatch"})
+		}
+	}
+
+	for _, spec := range archive.Specifiers() {
+		if seen[spec] {
+			continue
+		}
+		if module := archive.GetModule(spec); module != nil {
+			mismatches = append(mismatches, ReleaseMismatch{Specifier: spec, Reason: "present in archive but not listed in manifest"})
+		}
+	}
+
+	return mismatches, nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2018-2024 the Deno authors. All rights reserved. MIT license.
+
+package eszip
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// SignManifest produces a detached, armored OpenPGP signature over
+// manifest using the first private key found in the armored key material
+// at keyfile -- the same relationship an apt mirror's Release file has to
+// its sibling Release.gpg. The key must not be passphrase-protected;
+// decrypt it out-of-band first if it is.
+func SignManifest(manifest []byte, keyfile string) ([]byte, error) {
+	keyFile, err := os.Open(keyfile)
+	if err != nil {
+		return nil, fmt.Errorf("eszip: failed to open signing key %s: %w", keyfile, err)
+	}
+	defer keyFile.Close()
+
+	keyring, err := openpgp.ReadArmoredKeyRing(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("eszip: failed to read signing key %s: %w", keyfile, err)
+	}
+
+	var signer *openpgp.Entity
+	for _, entity := range keyring {
+		if entity.PrivateKey != nil {
+			signer = entity
+			break
+		}
+	}
+	if signer == nil {
+		return nil, fmt.Errorf("eszip: %s contains no private key", keyfile)
+	}
+
+	var signature bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&signature, signer, bytes.NewReader(manifest), nil); err != nil {
+		return nil, fmt.Errorf("eszip: failed to sign manifest: %w", err)
+	}
+
+	return signature.Bytes(), nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2018-2024 the Deno authors. All rights reserved. MIT license.
+
+package eszip
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// writeArmoredTestKey generates a throwaway OpenPGP entity and writes its
+// armored private key to a file under t.TempDir(), returning both the path
+// and the entity so the test can also check the signature against it.
+func writeArmoredTestKey(t *testing.T) (string, *openpgp.Entity) {
+	t.Helper()
+
+	entity, err := openpgp.NewEntity("eszip test signer", "", "signer@example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+
+	var buf bytes.Buffer
+	armorWriter, err := armor.Encode(&buf, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatalf("failed to open armor writer: %v", err)
+	}
+	if err := entity.SerializePrivate(armorWriter, nil); err != nil {
+		t.Fatalf("failed to serialize private key: %v", err)
+	}
+	if err := armorWriter.Close(); err != nil {
+		t.Fatalf("failed to close armor writer: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "signer.asc")
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatalf("failed to write test key: %v", err)
+	}
+
+	return path, entity
+}
+
+func TestSignManifestRoundTrip(t *testing.T) {
+	manifest, _, _ := buildReleaseManifestFixture(t)
+	manifestData := manifest.Encode()
+
+	keyPath, entity := writeArmoredTestKey(t)
+
+	signature, err := SignManifest(manifestData, keyPath)
+	if err != nil {
+		t.Fatalf("SignManifest failed: %v", err)
+	}
+
+	keyring := openpgp.EntityList{entity}
+	signer, err := openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(manifestData), bytes.NewReader(signature))
+	if err != nil {
+		t.Fatalf("failed to verify signature: %v", err)
+	}
+	if signer.PrimaryKey.KeyId != entity.PrimaryKey.KeyId {
+		t.Errorf("signature verified against the wrong key")
+	}
+
+	tampered := append(append([]byte{}, manifestData...), '\n')
+	if _, err := openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(tampered), bytes.NewReader(signature)); err == nil {
+		t.Error("expected signature check to fail against a tampered manifest")
+	}
+}
+
+func TestSignManifestRejectsMissingKeyfile(t *testing.T) {
+	manifest, _, _ := buildReleaseManifestFixture(t)
+	if _, err := SignManifest(manifest.Encode(), filepath.Join(t.TempDir(), "does-not-exist.asc")); err == nil {
+		t.Error("expected SignManifest to fail for a missing keyfile")
+	}
+}
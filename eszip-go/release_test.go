@@ -0,0 +1,159 @@
+// Copyright 2018-2024 the Deno authors. All rights reserved. MIT license.
+
+package eszip
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func buildReleaseManifestFixture(t *testing.T) (*ReleaseManifest, []byte, *EszipUnion) {
+	t.Helper()
+	ctx := context.Background()
+
+	e := NewV2()
+	e.AddModule("file:///main.ts", ModuleKindJavaScript, []byte("export const main = 1;"), nil)
+	e.AddModule("file:///dep.ts", ModuleKindJavaScript, []byte("export const dep = 2;"), nil)
+
+	data, err := e.IntoBytes()
+	if err != nil {
+		t.Fatalf("failed to serialize archive: %v", err)
+	}
+	union, err := ParseBytes(ctx, data)
+	if err != nil {
+		t.Fatalf("failed to parse archive: %v", err)
+	}
+
+	manifest, err := BuildReleaseManifest(ctx, data, union)
+	if err != nil {
+		t.Fatalf("failed to build manifest: %v", err)
+	}
+	return manifest, data, union
+}
+
+func TestBuildReleaseManifestAndEncodeRoundTrip(t *testing.T) {
+	manifest, _, _ := buildReleaseManifestFixture(t)
+
+	if len(manifest.Modules) != 2 {
+		t.Fatalf("expected 2 modules, got %d", len(manifest.Modules))
+	}
+	if manifest.Modules[0].Specifier != "file:///dep.ts" {
+		t.Errorf("expected modules sorted by specifier, got %q first", manifest.Modules[0].Specifier)
+	}
+
+	encoded := manifest.Encode()
+	parsed, err := ParseReleaseManifest(encoded)
+	if err != nil {
+		t.Fatalf("failed to parse encoded manifest: %v", err)
+	}
+
+	if parsed.FormatVersion != manifest.FormatVersion {
+		t.Errorf("FormatVersion mismatch: got %d, want %d", parsed.FormatVersion, manifest.FormatVersion)
+	}
+	if parsed.ArchiveSize != manifest.ArchiveSize {
+		t.Errorf("ArchiveSize mismatch: got %d, want %d", parsed.ArchiveSize, manifest.ArchiveSize)
+	}
+	if parsed.Archive != manifest.Archive {
+		t.Errorf("Archive digests mismatch: got %+v, want %+v", parsed.Archive, manifest.Archive)
+	}
+	if len(parsed.Modules) != len(manifest.Modules) {
+		t.Fatalf("expected %d modules, got %d", len(manifest.Modules), len(parsed.Modules))
+	}
+	for i, want := range manifest.Modules {
+		got := parsed.Modules[i]
+		if got != want {
+			t.Errorf("module %d mismatch: got %+v, want %+v", i, got, want)
+		}
+	}
+}
+
+func TestReleaseManifestVerifyDetectsTampering(t *testing.T) {
+	ctx := context.Background()
+	manifest, data, union := buildReleaseManifestFixture(t)
+
+	if mismatches, err := manifest.Verify(ctx, data, union); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	} else if len(mismatches) != 0 {
+		t.Errorf("expected no mismatches for an untampered archive, got %+v", mismatches)
+	}
+
+	tampered := NewV2()
+	tampered.AddModule("file:///main.ts", ModuleKindJavaScript, []byte("export const main = 999;"), nil)
+	tampered.AddModule("file:///dep.ts", ModuleKindJavaScript, []byte("export const dep = 2;"), nil)
+	tamperedData, err := tampered.IntoBytes()
+	if err != nil {
+		t.Fatalf("failed to serialize tampered archive: %v", err)
+	}
+	tamperedUnion, err := ParseBytes(ctx, tamperedData)
+	if err != nil {
+		t.Fatalf("failed to parse tampered archive: %v", err)
+	}
+
+	mismatches, err := manifest.Verify(ctx, tamperedData, tamperedUnion)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if len(mismatches) < 2 {
+		t.Fatalf("expected at least an archive mismatch and a main.ts mismatch, got %+v", mismatches)
+	}
+
+	var foundArchive, foundMain bool
+	for _, m := range mismatches {
+		if m.Specifier == "(archive)" {
+			foundArchive = true
+		}
+		if m.Specifier == "file:///main.ts" {
+			foundMain = true
+		}
+	}
+	if !foundArchive || !foundMain {
+		t.Errorf("expected archive and file:///main.ts mismatches, got %+v", mismatches)
+	}
+}
+
+func TestReleaseManifestVerifyDetectsMissingModule(t *testing.T) {
+	ctx := context.Background()
+	manifest, _, _ := buildReleaseManifestFixture(t)
+
+	smaller := NewV2()
+	smaller.AddModule("file:///dep.ts", ModuleKindJavaScript, []byte("export const dep = 2;"), nil)
+	data, err := smaller.IntoBytes()
+	if err != nil {
+		t.Fatalf("failed to serialize archive: %v", err)
+	}
+	union, err := ParseBytes(ctx, data)
+	if err != nil {
+		t.Fatalf("failed to parse archive: %v", err)
+	}
+
+	mismatches, err := manifest.Verify(ctx, nil, union)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	var found bool
+	for _, m := range mismatches {
+		if m.Specifier == "file:///main.ts" && m.Reason == "listed in manifest but not found in archive" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected a missing-module mismatch for file:///main.ts, got %+v", mismatches)
+	}
+}
+
+func TestDigestsOfIsDeterministic(t *testing.T) {
+	data := []byte("export const x = 1;")
+	a := digestsOf(data)
+	b := digestsOf(data)
+	if a != b {
+		t.Errorf("expected digestsOf to be deterministic, got %+v vs %+v", a, b)
+	}
+	if digestsOf([]byte("different")) == a {
+		t.Errorf("expected different content to produce different digests")
+	}
+	if !bytes.Equal([]byte(a.SHA256), []byte(b.SHA256)) {
+		t.Errorf("SHA256 digest should round trip as the same string")
+	}
+}
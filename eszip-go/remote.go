@@ -0,0 +1,183 @@
+// Copyright 2018-2024 the Deno authors. All rights reserved. MIT license.
+
+package eszip
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// remoteHeaderPrefetchSize is how many leading bytes OpenRemote fetches in
+// its single up-front ranged GET. Real eszip archives keep their options,
+// modules, and npm sections well under this, so in practice the whole
+// header+index region is served from this one request and only module
+// sources trigger further ranged GETs.
+const remoteHeaderPrefetchSize = 256 * 1024
+
+// OpenRemote opens a V2 eszip archive served at url without downloading it
+// in full. It issues one ranged GET for the leading remoteHeaderPrefetchSize
+// bytes -- enough to cover the options, modules, and npm sections -- parses
+// those eagerly the same way ParseV2Lazy does for a local file, and defers
+// every module's source and source map to an on-demand ranged GET, fetched
+// the first time Module.Source/SourceMap is called.
+//
+// The server must advertise support for ranged requests (RFC 7233) by
+// responding to the prefetch with 206 Partial Content and a Content-Range
+// header; servers that don't are rejected so the caller can fall back to a
+// full streaming download through Parse.
+func OpenRemote(ctx context.Context, url string) (*EszipUnion, error) {
+	client := http.DefaultClient
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", remoteHeaderPrefetchSize-1))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errIO(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("eszip: %s does not support ranged requests (got status %s)", url, resp.Status)
+	}
+
+	size, ok := parseContentRangeSize(resp.Header.Get("Content-Range"))
+	if !ok {
+		return nil, fmt.Errorf("eszip: %s sent no usable Content-Range header", url)
+	}
+
+	prefix, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errIO(err)
+	}
+
+	ra := &httpRangeReaderAt{ctx: ctx, client: client, url: url, prefix: prefix}
+	v2, err := ParseV2Lazy(ctx, ra, size)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EszipUnion{v2: v2}, nil
+}
+
+// parseContentRangeSize extracts the total resource size from a
+// "bytes start-end/size" Content-Range header value.
+func parseContentRangeSize(contentRange string) (int64, bool) {
+	idx := strings.LastIndex(contentRange, "/")
+	if idx < 0 || idx == len(contentRange)-1 {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(contentRange[idx+1:], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return size, true
+}
+
+// httpRangeReaderAt implements io.ReaderAt against a URL that has already
+// been confirmed to support ranged requests. Reads within prefix (the bytes
+// OpenRemote prefetched) are served from memory; reads past it issue one
+// ranged GET each, which is how individual module sources are loaded lazily.
+type httpRangeReaderAt struct {
+	ctx    context.Context
+	client *http.Client
+	url    string
+	prefix []byte
+}
+
+func (r *httpRangeReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if off >= 0 && off+int64(len(p)) <= int64(len(r.prefix)) {
+		return copy(p, r.prefix[off:off+int64(len(p))]), nil
+	}
+
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))-1))
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, errIO(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, fmt.Errorf("eszip: range request to %s returned status %s, expected 206", r.url, resp.Status)
+	}
+
+	return io.ReadFull(resp.Body, p)
+}
+
+// FetchHTTP fetches and parses an eszip archive (V1 or V2) served at url,
+// streaming the response body through Parse so module sources become
+// available as complete finishes reading them rather than only after the
+// whole body has arrived. It requests "Accept-Encoding: gzip, deflate" and
+// transparently un-gzips the response if the server compresses it at the
+// transport level -- distinct from eszip's own per-module V2.4+ compression,
+// which Parse already understands natively.
+//
+// Use this for servers that don't support ranged requests; OpenRemote is
+// preferable when they do, since it avoids downloading sources that are
+// never asked for.
+func FetchHTTP(ctx context.Context, url string) (*EszipUnion, func(context.Context) error, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, errIO(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, nil, fmt.Errorf("eszip: GET %s returned status %s", url, resp.Status)
+	}
+
+	body, err := decodeContentEncoding(resp)
+	if err != nil {
+		resp.Body.Close()
+		return nil, nil, err
+	}
+
+	union, complete, err := Parse(ctx, body)
+	if err != nil {
+		resp.Body.Close()
+		return nil, nil, err
+	}
+
+	wrappedComplete := func(ctx context.Context) error {
+		defer resp.Body.Close()
+		return complete(ctx)
+	}
+
+	return union, wrappedComplete, nil
+}
+
+// decodeContentEncoding wraps resp.Body in a gzip.Reader when the server
+// compressed the response at the transport level, leaving it untouched
+// otherwise. The caller remains responsible for closing resp.Body.
+func decodeContentEncoding(resp *http.Response) (io.Reader, error) {
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		return resp.Body, nil
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return nil, errIO(err)
+	}
+	return gz, nil
+}
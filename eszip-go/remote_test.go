@@ -0,0 +1,124 @@
+// Copyright 2018-2024 the Deno authors. All rights reserved. MIT license.
+
+package eszip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func syntheticArchiveBytes(t testing.TB) []byte {
+	t.Helper()
+
+	e := NewV2()
+	e.AddModule("file:///main.ts", ModuleKindJavaScript, []byte("export const main = 1;"), nil)
+	e.AddModule("file:///dep.ts", ModuleKindJavaScript, []byte("export const dep = 2;"), nil)
+
+	data, err := e.IntoBytes()
+	if err != nil {
+		t.Fatalf("failed to serialize synthetic archive: %v", err)
+	}
+	return data
+}
+
+func TestOpenRemoteRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	data := syntheticArchiveBytes(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "archive.eszip2", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	archive, err := OpenRemote(ctx, server.URL)
+	if err != nil {
+		t.Fatalf("OpenRemote failed: %v", err)
+	}
+
+	module := archive.GetModule("file:///main.ts")
+	if module == nil {
+		t.Fatal("expected to find file:///main.ts")
+	}
+	source, err := module.Source(ctx)
+	if err != nil {
+		t.Fatalf("failed to get source: %v", err)
+	}
+	if string(source) != "export const main = 1;" {
+		t.Errorf("unexpected source: %s", source)
+	}
+
+	dep := archive.GetModule("file:///dep.ts")
+	if dep == nil {
+		t.Fatal("expected to find file:///dep.ts")
+	}
+	depSource, err := dep.Source(ctx)
+	if err != nil {
+		t.Fatalf("failed to get dep source: %v", err)
+	}
+	if string(depSource) != "export const dep = 2;" {
+		t.Errorf("unexpected dep source: %s", depSource)
+	}
+}
+
+func TestOpenRemoteRejectsNonRangingServer(t *testing.T) {
+	ctx := context.Background()
+	data := syntheticArchiveBytes(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	if _, err := OpenRemote(ctx, server.URL); err == nil {
+		t.Error("expected OpenRemote to reject a server that ignores Range requests")
+	}
+}
+
+func TestFetchHTTPTransparentGzip(t *testing.T) {
+	ctx := context.Background()
+	data := syntheticArchiveBytes(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write(data)
+		gz.Close()
+	}))
+	defer server.Close()
+
+	archive, complete, err := FetchHTTP(ctx, server.URL)
+	if err != nil {
+		t.Fatalf("FetchHTTP failed: %v", err)
+	}
+	if err := complete(ctx); err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+
+	module := archive.GetModule("file:///main.ts")
+	if module == nil {
+		t.Fatal("expected to find file:///main.ts")
+	}
+	source, err := module.Source(ctx)
+	if err != nil {
+		t.Fatalf("failed to get source: %v", err)
+	}
+	if string(source) != "export const main = 1;" {
+		t.Errorf("unexpected source: %s", source)
+	}
+}
+
+func TestParseContentRangeSize(t *testing.T) {
+	size, ok := parseContentRangeSize("bytes 0-255/1024")
+	if !ok || size != 1024 {
+		t.Errorf("expected (1024, true), got (%d, %v)", size, ok)
+	}
+
+	if _, ok := parseContentRangeSize("garbage"); ok {
+		t.Error("expected malformed Content-Range to be rejected")
+	}
+}
@@ -5,6 +5,7 @@ package eszip
 import (
 	"context"
 	"encoding/json"
+	"iter"
 	"net/url"
 	"sync"
 )
@@ -106,9 +107,10 @@ func (e *EszipV1) GetModule(specifier string) *Module {
 		}
 
 		return &Module{
-			Specifier: current,
-			Kind:      ModuleKindJavaScript,
-			inner:     &v1ModuleInner{eszip: e},
+			Specifier:          current,
+			RequestedSpecifier: specifier,
+			Kind:               ModuleKindJavaScript,
+			inner:              &v1ModuleInner{eszip: e},
 		}
 	}
 }
@@ -189,26 +191,40 @@ func (v *v1ModuleInner) takeSourceMap(ctx context.Context, specifier string) ([]
 	return nil, nil
 }
 
-// Iterate returns all modules as an iterator
+// All returns an iterator over every specifier/module pair. Unlike Iterate,
+// it doesn't materialize the whole module list up front, so a consumer that
+// breaks out early skips the cost of resolving the remaining modules.
+func (e *EszipV1) All() iter.Seq2[string, *Module] {
+	return func(yield func(string, *Module) bool) {
+		for _, spec := range e.Specifiers() {
+			module := e.GetModule(spec)
+			if module == nil {
+				continue
+			}
+			if !yield(spec, module) {
+				return
+			}
+		}
+	}
+}
+
+// Iterate returns all modules as a slice.
+//
+// Deprecated: range over All instead; unlike this method, it doesn't
+// eagerly resolve every module before the caller can use any of them.
 func (e *EszipV1) Iterate() []struct {
 	Specifier string
 	Module    *Module
 } {
-	specs := e.Specifiers()
-	result := make([]struct {
+	var result []struct {
 		Specifier string
 		Module    *Module
-	}, 0, len(specs))
-
-	for _, spec := range specs {
-		module := e.GetModule(spec)
-		if module != nil {
-			result = append(result, struct {
-				Specifier string
-				Module    *Module
-			}{Specifier: spec, Module: module})
-		}
 	}
-
+	for spec, module := range e.All() {
+		result = append(result, struct {
+			Specifier string
+			Module    *Module
+		}{Specifier: spec, Module: module})
+	}
 	return result
 }
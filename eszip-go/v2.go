@@ -4,6 +4,7 @@ package eszip
 
 import (
 	"context"
+	"crypto/sha256"
 	"sync"
 )
 
@@ -13,6 +14,8 @@ var (
 	MagicV2_1 = [8]byte{'E', 'S', 'Z', 'I', 'P', '2', '.', '1'}
 	MagicV2_2 = [8]byte{'E', 'S', 'Z', 'I', 'P', '2', '.', '2'}
 	MagicV2_3 = [8]byte{'E', 'S', 'Z', 'I', 'P', '2', '.', '3'}
+	MagicV2_4 = [8]byte{'E', 'S', 'Z', 'I', 'P', '2', '.', '4'}
+	MagicV2_5 = [8]byte{'E', 'S', 'Z', 'I', 'P', '2', '.', '5'}
 )
 
 // EszipVersion represents the V2 version
@@ -23,10 +26,12 @@ const (
 	VersionV2_1 EszipVersion = 1
 	VersionV2_2 EszipVersion = 2
 	VersionV2_3 EszipVersion = 3
+	VersionV2_4 EszipVersion = 4
+	VersionV2_5 EszipVersion = 5
 )
 
 // LatestVersion is the latest supported version
-const LatestVersion = VersionV2_3
+const LatestVersion = VersionV2_5
 
 // VersionFromMagic returns the version from magic bytes
 func VersionFromMagic(magic []byte) (EszipVersion, bool) {
@@ -45,6 +50,10 @@ func VersionFromMagic(magic []byte) (EszipVersion, bool) {
 		return VersionV2_2, true
 	case MagicV2_3:
 		return VersionV2_3, true
+	case MagicV2_4:
+		return VersionV2_4, true
+	case MagicV2_5:
+		return VersionV2_5, true
 	default:
 		return 0, false
 	}
@@ -61,8 +70,12 @@ func (v EszipVersion) ToMagic() [8]byte {
 		return MagicV2_2
 	case VersionV2_3:
 		return MagicV2_3
+	case VersionV2_4:
+		return MagicV2_4
+	case VersionV2_5:
+		return MagicV2_5
 	default:
-		return MagicV2_3
+		return MagicV2_5
 	}
 }
 
@@ -76,6 +89,19 @@ func (v EszipVersion) SupportsOptions() bool {
 	return v >= VersionV2_2
 }
 
+// SupportsCompression returns true if the version stores a per-entry
+// uncompressed length alongside each module's source/source-map offsets.
+func (v EszipVersion) SupportsCompression() bool {
+	return v >= VersionV2_4
+}
+
+// SupportsSortedIndex returns true if the modules header is laid out as a
+// string blob plus a sorted (specifier offset, entry offset) index instead
+// of a flat, linearly-scanned list of entries. See ModulesIndex.
+func (v EszipVersion) SupportsSortedIndex() bool {
+	return v >= VersionV2_5
+}
+
 // HeaderFrameKind represents the type of entry in the modules header
 type HeaderFrameKind uint8
 
@@ -89,6 +115,19 @@ const (
 type Options struct {
 	Checksum     ChecksumType
 	ChecksumSize uint8
+	Compression  CompressionType
+	// Chunking enables content-defined chunking and deduplication of the
+	// sources section (see splitContentDefined). When true, each module's
+	// source offset/length pair in the modules header instead means
+	// (chunkIndexOffset, chunkCount) into the chunks section.
+	Chunking bool
+	// NpmDepKinds indicates that each dependency entry in the npm section
+	// carries a one-byte NpmDependencyKind tag before its package index,
+	// letting NpmPackage round-trip peer and optional dependencies and not
+	// just Dependencies. It's set automatically by IntoBytes when the
+	// snapshot being written has any such dependency, so archives without
+	// them keep writing the older, tag-less format.
+	NpmDepKinds bool
 }
 
 // DefaultOptionsForVersion returns the default options for a version
@@ -112,12 +151,31 @@ func (o Options) GetChecksumSize() uint8 {
 	return o.Checksum.DigestSize()
 }
 
+// BuildOptions configures how IntoBytes lays out the sources and source
+// maps sections. Unlike Options, these settings don't change the wire
+// format -- readers never need to know a BuildOptions was used -- they only
+// affect how the writer arranges bytes that were already going to be
+// written.
+type BuildOptions struct {
+	// Dedupe, when true, hashes each source/source-map blob during
+	// IntoBytes and writes identical blobs into the sources section only
+	// once, pointing every module that shares that content at the same
+	// (offset, length). This is a cheaper alternative to SetChunking for
+	// archives where duplication is whole-blob (e.g. a generated file
+	// vendored under several specifiers) rather than partial overlap.
+	Dedupe bool
+	// DedupeHash is the hash algorithm used to key the dedup table.
+	// Defaults to ChecksumXxh3 when left as ChecksumNone.
+	DedupeHash ChecksumType
+}
+
 // EszipV2 represents a V2 eszip archive
 type EszipV2 struct {
-	modules     *ModuleMap
-	npmSnapshot *NpmResolutionSnapshot
-	options     Options
-	version     EszipVersion
+	modules      *ModuleMap
+	npmSnapshot  *NpmResolutionSnapshot
+	options      Options
+	version      EszipVersion
+	buildOptions BuildOptions
 }
 
 // NewEszipV2 creates a new empty V2 eszip
@@ -129,6 +187,14 @@ func NewEszipV2() *EszipV2 {
 	}
 }
 
+// NewV2WithOptions creates a new empty V2 eszip whose IntoBytes output is
+// shaped by opts (see BuildOptions).
+func NewV2WithOptions(opts BuildOptions) *EszipV2 {
+	eszip := NewEszipV2()
+	eszip.buildOptions = opts
+	return eszip
+}
+
 // HasMagic checks if the buffer starts with a V2 magic
 func HasMagic(buffer []byte) bool {
 	if len(buffer) < 8 {
@@ -169,9 +235,10 @@ func (e *EszipV2) getModuleInternal(specifier string, allowJsonc bool) *Module {
 				return nil
 			}
 			return &Module{
-				Specifier: current,
-				Kind:      m.Kind,
-				inner:     &v2ModuleInner{eszip: e},
+				Specifier:          current,
+				RequestedSpecifier: specifier,
+				Kind:               m.Kind,
+				inner:              &v2ModuleInner{eszip: e},
 			}
 		case *ModuleRedirect:
 			current = m.Target
@@ -189,6 +256,85 @@ func (e *EszipV2) Specifiers() []string {
 	return e.modules.Keys()
 }
 
+// SourceSizes returns the on-disk (possibly compressed) and original
+// uncompressed length of specifier's source. Redirects are not followed:
+// it reports ok=false for anything that isn't a plain module, e.g. a
+// redirect or an npm specifier. uncompressed equals compressed whenever
+// the archive was written without compression.
+func (e *EszipV2) SourceSizes(specifier string) (compressed, uncompressed uint32, ok bool) {
+	mod, found := e.modules.Get(specifier)
+	if !found {
+		return 0, 0, false
+	}
+	data, isData := mod.(*ModuleData)
+	if !isData {
+		return 0, 0, false
+	}
+
+	compressed = data.Source.Length()
+	uncompressed = data.UncompressedSourceLen
+	if uncompressed == 0 {
+		uncompressed = compressed
+	}
+	return compressed, uncompressed, true
+}
+
+// ResolveSpecifier follows the redirect chain starting at spec and returns
+// the terminal specifier, the full chain of specifiers visited (starting
+// with spec and ending with final), and whether resolution succeeded. It
+// returns ok=false if spec isn't present, the chain cycles, or it doesn't
+// end at an actual module.
+func (e *EszipV2) ResolveSpecifier(spec string) (final string, chain []string, ok bool) {
+	visited := make(map[string]bool)
+	current := spec
+	chain = []string{spec}
+
+	for {
+		if visited[current] {
+			return "", nil, false
+		}
+		visited[current] = true
+
+		mod, exists := e.modules.Get(current)
+		if !exists {
+			return "", nil, false
+		}
+
+		switch m := mod.(type) {
+		case *ModuleData:
+			return current, chain, true
+		case *ModuleRedirect:
+			current = m.Target
+			chain = append(chain, current)
+		default:
+			return "", nil, false
+		}
+	}
+}
+
+// Redirects returns a snapshot of every redirect entry in the archive,
+// mapping each redirect specifier directly to its target. Unlike
+// ResolveSpecifier, targets here are not followed to their terminal module.
+func (e *EszipV2) Redirects() map[string]string {
+	redirects := make(map[string]string)
+	for _, specifier := range e.modules.Keys() {
+		mod, ok := e.modules.Get(specifier)
+		if !ok {
+			continue
+		}
+		if r, ok := mod.(*ModuleRedirect); ok {
+			redirects[specifier] = r.Target
+		}
+	}
+	return redirects
+}
+
+// NpmSnapshot returns the archive's NPM resolution snapshot without
+// removing it, or nil if none is set.
+func (e *EszipV2) NpmSnapshot() *NpmResolutionSnapshot {
+	return e.npmSnapshot
+}
+
 // TakeNpmSnapshot removes and returns the NPM snapshot
 func (e *EszipV2) TakeNpmSnapshot() *NpmResolutionSnapshot {
 	snapshot := e.npmSnapshot
@@ -196,27 +342,51 @@ func (e *EszipV2) TakeNpmSnapshot() *NpmResolutionSnapshot {
 	return snapshot
 }
 
+// Options returns the options this archive was parsed with, or will be
+// written with, e.g. to report the checksum/compression algorithm in use.
+func (e *EszipV2) Options() Options {
+	return e.options
+}
+
 // SetChecksum sets the checksum algorithm
 func (e *EszipV2) SetChecksum(checksum ChecksumType) {
 	e.options.Checksum = checksum
 	e.options.ChecksumSize = checksum.DigestSize()
 }
 
+// SetCompression sets the compression algorithm used for source and
+// source-map payloads. Only archives written at VersionV2_4 or later can
+// carry compressed entries; IntoBytes always targets LatestVersion, so this
+// takes effect immediately.
+func (e *EszipV2) SetCompression(compression CompressionType) {
+	e.options.Compression = compression
+}
+
+// SetChunking enables or disables content-defined chunking and
+// deduplication of the sources section. This trades some extra CPU while
+// writing for substantial size savings when many modules share common
+// content, e.g. multiple versions of the same npm package.
+func (e *EszipV2) SetChunking(enabled bool) {
+	e.options.Chunking = enabled
+}
+
 // AddModule adds a module to the archive
 func (e *EszipV2) AddModule(specifier string, kind ModuleKind, source, sourceMap []byte) {
 	e.modules.Insert(specifier, &ModuleData{
-		Kind:      kind,
-		Source:    NewReadySourceSlot(source),
-		SourceMap: NewReadySourceSlot(sourceMap),
+		Kind:       kind,
+		Source:     NewReadySourceSlot(source),
+		SourceMap:  NewReadySourceSlot(sourceMap),
+		SourceHash: sha256.Sum256(source),
 	})
 }
 
 // AddImportMap adds an import map at the front of the archive
 func (e *EszipV2) AddImportMap(kind ModuleKind, specifier string, source []byte) {
 	e.modules.InsertFront(specifier, &ModuleData{
-		Kind:      kind,
-		Source:    NewReadySourceSlot(source),
-		SourceMap: NewEmptySourceSlot(),
+		Kind:       kind,
+		Source:     NewReadySourceSlot(source),
+		SourceMap:  NewEmptySourceSlot(),
+		SourceHash: sha256.Sum256(source),
 	})
 }
 
@@ -365,6 +535,11 @@ type parserState struct {
 }
 
 type sourceOffsetEntry struct {
-	length    int
-	specifier string
+	length int
+	// specifiers lists every module specifier whose slot lives at this
+	// offset. Usually a single entry, but a dedup-aware writer (see
+	// BuildOptions.Dedupe) can point several modules at the same
+	// (offset, length), so every one of them needs to be marked ready once
+	// that content is read.
+	specifiers []string
 }
@@ -0,0 +1,331 @@
+// Copyright 2018-2024 the Deno authors. All rights reserved. MIT license.
+
+package eszip
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// archiveManifestName holds the JSON manifest mapping each entry's sanitized
+// path back to its original specifier. WriteAsTar/WriteAsZip sanitize
+// specifiers into filesystem-safe paths for browsability, which is lossy;
+// FromTar/FromZip read the manifest rather than trying to reverse it.
+const archiveManifestName = "eszip-manifest.json"
+
+// archiveNpmSnapshotName holds the serialized NPM resolution snapshot, if
+// the archive has one.
+const archiveNpmSnapshotName = "npm-snapshot.json"
+
+// archiveManifestEntry describes one module or redirect written by
+// WriteAsTar/WriteAsZip.
+type archiveManifestEntry struct {
+	Specifier string `json:"specifier"`
+	Path      string `json:"path"`
+	Kind      string `json:"kind,omitempty"`
+	Redirect  string `json:"redirect,omitempty"`
+}
+
+// sanitizeSpecifierPath turns a module specifier (typically a URL) into a
+// relative path that's safe to use as a tar or zip entry name: the scheme
+// separator becomes a path segment, characters that are illegal (or
+// awkward) in archive entry names are replaced with "_", and "."/".."
+// path segments are replaced with "_" so a crafted specifier can't write
+// outside the archive root when extracted with ordinary tar/unzip tooling.
+func sanitizeSpecifierPath(specifier string) string {
+	s := strings.ReplaceAll(specifier, "://", "/")
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '<' || r == '>' || r == ':' || r == '"' || r == '|' || r == '?' || r == '*' || r == '\\' || r < 0x20:
+			b.WriteByte('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	s = strings.TrimPrefix(b.String(), "/")
+
+	segments := strings.Split(s, "/")
+	for i, seg := range segments {
+		if seg == "." || seg == ".." {
+			segments[i] = "_"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func archiveExtensionForKind(kind ModuleKind) string {
+	switch kind {
+	case ModuleKindJavaScript:
+		return "js"
+	case ModuleKindJson:
+		return "json"
+	case ModuleKindJsonc:
+		return "jsonc"
+	case ModuleKindWasm:
+		return "wasm"
+	default:
+		return "bin"
+	}
+}
+
+// WriteAsTar writes the archive as a tar stream for inspection with ordinary
+// Unix tooling: each module becomes "<path>/source.<ext>" plus
+// "<path>/source.map.json" (when a source map is present), each redirect
+// becomes a symlink pointing at its target's path, and the npm snapshot (if
+// any) is written to npm-snapshot.json. Use IntoBytes/ParseV2 to round-trip
+// an eszip losslessly; this is a browsable export, not a primary format.
+func (e *EszipV2) WriteAsTar(ctx context.Context, w io.Writer) error {
+	tw := tar.NewWriter(w)
+
+	manifest, err := e.writeArchiveModules(ctx, func(name string, content []byte) error {
+		return writeTarFile(tw, name, content)
+	}, func(name, target string) error {
+		return tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeSymlink,
+			Name:     name,
+			Linkname: target,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := e.writeArchiveSidecars(manifest, func(name string, content []byte) error {
+		return writeTarFile(tw, name, content)
+	}); err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// WriteAsZip writes the archive as a zip stream. It mirrors WriteAsTar,
+// except that zip has no symlink entry type, so redirects are written as
+// plain text files containing their target specifier.
+func (e *EszipV2) WriteAsZip(ctx context.Context, w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	manifest, err := e.writeArchiveModules(ctx, func(name string, content []byte) error {
+		return writeZipFile(zw, name, content)
+	}, func(name, target string) error {
+		return writeZipFile(zw, name, []byte(target))
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := e.writeArchiveSidecars(manifest, func(name string, content []byte) error {
+		return writeZipFile(zw, name, content)
+	}); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// writeArchiveModules walks e.modules, writing each ModuleData's source (and
+// source map, if present) via writeFile and each ModuleRedirect via
+// writeLink, and returns the manifest describing what was written.
+func (e *EszipV2) writeArchiveModules(ctx context.Context, writeFile func(name string, content []byte) error, writeLink func(name, target string) error) ([]archiveManifestEntry, error) {
+	var manifest []archiveManifestEntry
+
+	for _, specifier := range e.modules.Keys() {
+		mod, ok := e.modules.Get(specifier)
+		if !ok {
+			continue
+		}
+		path := sanitizeSpecifierPath(specifier)
+
+		switch m := mod.(type) {
+		case *ModuleData:
+			source, err := m.Source.Get(ctx)
+			if err != nil {
+				return nil, err
+			}
+			sourcePath := fmt.Sprintf("%s/source.%s", path, archiveExtensionForKind(m.Kind))
+			if err := writeFile(sourcePath, source); err != nil {
+				return nil, err
+			}
+
+			sourceMap, err := m.SourceMap.Get(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if len(sourceMap) > 0 {
+				if err := writeFile(path+"/source.map.json", sourceMap); err != nil {
+					return nil, err
+				}
+			}
+
+			manifest = append(manifest, archiveManifestEntry{Specifier: specifier, Path: path, Kind: m.Kind.String()})
+
+		case *ModuleRedirect:
+			targetPath := sanitizeSpecifierPath(m.Target)
+			if err := writeLink(path, targetPath); err != nil {
+				return nil, err
+			}
+			manifest = append(manifest, archiveManifestEntry{Specifier: specifier, Path: path, Redirect: m.Target})
+		}
+	}
+
+	return manifest, nil
+}
+
+func (e *EszipV2) writeArchiveSidecars(manifest []archiveManifestEntry, writeFile func(name string, content []byte) error) error {
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFile(archiveManifestName, manifestJSON); err != nil {
+		return err
+	}
+
+	if e.npmSnapshot != nil {
+		npmJSON, err := json.MarshalIndent(e.npmSnapshot, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeFile(archiveNpmSnapshotName, npmJSON); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, content []byte) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name: name,
+		Mode: 0o644,
+		Size: int64(len(content)),
+	}); err != nil {
+		return err
+	}
+	_, err := tw.Write(content)
+	return err
+}
+
+func writeZipFile(zw *zip.Writer, name string, content []byte) error {
+	fw, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = fw.Write(content)
+	return err
+}
+
+// FromTar reads an archive previously written by WriteAsTar, reconstructing
+// the original modules, redirects, and npm snapshot from its manifest.
+func FromTar(r io.Reader) (*EszipV2, error) {
+	files := make(map[string][]byte)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errIO(err)
+		}
+		if hdr.Typeflag == tar.TypeSymlink {
+			files[hdr.Name] = []byte(hdr.Linkname)
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, tr); err != nil {
+			return nil, errIO(err)
+		}
+		files[hdr.Name] = buf.Bytes()
+	}
+	return eszipFromArchiveFiles(files)
+}
+
+// FromZip reads an archive previously written by WriteAsZip, reconstructing
+// the original modules, redirects, and npm snapshot from its manifest.
+func FromZip(ra io.ReaderAt, size int64) (*EszipV2, error) {
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, errIO(err)
+	}
+
+	files := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, errIO(err)
+		}
+		var buf bytes.Buffer
+		_, err = io.Copy(&buf, rc)
+		rc.Close()
+		if err != nil {
+			return nil, errIO(err)
+		}
+		files[f.Name] = buf.Bytes()
+	}
+	return eszipFromArchiveFiles(files)
+}
+
+func eszipFromArchiveFiles(files map[string][]byte) (*EszipV2, error) {
+	manifestJSON, ok := files[archiveManifestName]
+	if !ok {
+		return nil, errInvalidV2Header("missing " + archiveManifestName)
+	}
+	var manifest []archiveManifestEntry
+	if err := json.Unmarshal(manifestJSON, &manifest); err != nil {
+		return nil, errInvalidV2Header("malformed " + archiveManifestName + ": " + err.Error())
+	}
+
+	e := NewV2()
+
+	for _, entry := range manifest {
+		if entry.Redirect != "" {
+			e.AddRedirect(entry.Specifier, entry.Redirect)
+			continue
+		}
+
+		kind := archiveKindFromModuleKindString(entry.Kind)
+		sourcePath := fmt.Sprintf("%s/source.%s", entry.Path, archiveExtensionForKind(kind))
+		source, ok := files[sourcePath]
+		if !ok {
+			return nil, errInvalidV2Header("missing source for " + entry.Specifier)
+		}
+		sourceMap := files[entry.Path+"/source.map.json"]
+
+		e.AddModule(entry.Specifier, kind, source, sourceMap)
+	}
+
+	if npmJSON, ok := files[archiveNpmSnapshotName]; ok {
+		var snapshot NpmResolutionSnapshot
+		if err := json.Unmarshal(npmJSON, &snapshot); err != nil {
+			return nil, errInvalidV2Header("malformed " + archiveNpmSnapshotName + ": " + err.Error())
+		}
+		e.npmSnapshot = &snapshot
+	}
+
+	return e, nil
+}
+
+func archiveKindFromModuleKindString(s string) ModuleKind {
+	switch s {
+	case "javascript":
+		return ModuleKindJavaScript
+	case "json":
+		return ModuleKindJson
+	case "jsonc":
+		return ModuleKindJsonc
+	case "wasm":
+		return ModuleKindWasm
+	default:
+		return ModuleKindOpaqueData
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2018-2024 the Deno authors. All rights reserved. MIT license.
+
+package eszip
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// blockDiffBlockSize is the minimum run length encodeBlockPatch will copy
+// from the old source instead of inserting literally. Smaller values find
+// more matches at the cost of a larger block index and more copy
+// instructions; this is tuned for source-code-sized edits (a changed
+// function in an otherwise-unchanged file), not binary data.
+const blockDiffBlockSize = 16
+
+const (
+	blockPatchOpCopy   byte = 0
+	blockPatchOpInsert byte = 1
+)
+
+// buildBlockIndex maps every blockDiffBlockSize-byte window of old to the
+// first offset it occurs at, so encodeBlockPatch can look up candidate
+// matches for any position in new in O(1).
+func buildBlockIndex(old []byte) map[uint64]int {
+	index := make(map[uint64]int)
+	for i := 0; i+blockDiffBlockSize <= len(old); i++ {
+		h := fnv1a(old[i : i+blockDiffBlockSize])
+		if _, exists := index[h]; !exists {
+			index[h] = i
+		}
+	}
+	return index
+}
+
+func fnv1a(b []byte) uint64 {
+	var h uint64 = 14695981039346656037
+	for _, c := range b {
+		h ^= uint64(c)
+		h *= 1099511628211
+	}
+	return h
+}
+
+// encodeBlockPatch diffs new against old, greedily preferring to copy runs
+// of bytes that already exist somewhere in old over inserting them
+// literally. The result is a self-describing instruction stream consumed
+// by applyBlockPatch; it reconstructs new exactly, but is only worth using
+// over a full replacement when it comes out smaller (see DiffArchives).
+func encodeBlockPatch(old, new []byte) []byte {
+	index := buildBlockIndex(old)
+
+	var out []byte
+	var literal []byte
+
+	flushLiteral := func() {
+		if len(literal) == 0 {
+			return
+		}
+		out = append(out, blockPatchOpInsert)
+		out = appendU32BE(out, uint32(len(literal)))
+		out = append(out, literal...)
+		literal = nil
+	}
+
+	i := 0
+	for i < len(new) {
+		if i+blockDiffBlockSize <= len(new) {
+			h := fnv1a(new[i : i+blockDiffBlockSize])
+			if oldOffset, ok := index[h]; ok && blockDiffEqual(old, oldOffset, new, i) {
+				length := blockDiffBlockSize
+				for oldOffset+length < len(old) && i+length < len(new) && old[oldOffset+length] == new[i+length] {
+					length++
+				}
+				flushLiteral()
+				out = append(out, blockPatchOpCopy)
+				out = appendU32BE(out, uint32(oldOffset))
+				out = appendU32BE(out, uint32(length))
+				i += length
+				continue
+			}
+		}
+		literal = append(literal, new[i])
+		i++
+	}
+	flushLiteral()
+
+	return out
+}
+
+func blockDiffEqual(old []byte, oldOffset int, new []byte, newOffset int) bool {
+	for k := 0; k < blockDiffBlockSize; k++ {
+		if old[oldOffset+k] != new[newOffset+k] {
+			return false
+		}
+	}
+	return true
+}
+
+// applyBlockPatch replays an instruction stream produced by
+// encodeBlockPatch against old, reconstructing the diffed new content.
+func applyBlockPatch(old, patch []byte) ([]byte, error) {
+	var out []byte
+	read := 0
+
+	for read < len(patch) {
+		op := patch[read]
+		read++
+
+		switch op {
+		case blockPatchOpCopy:
+			if read+8 > len(patch) {
+				return nil, fmt.Errorf("eszip: truncated copy instruction in patch")
+			}
+			offset := binary.BigEndian.Uint32(patch[read : read+4])
+			length := binary.BigEndian.Uint32(patch[read+4 : read+8])
+			read += 8
+			if uint64(offset)+uint64(length) > uint64(len(old)) {
+				return nil, fmt.Errorf("eszip: copy instruction out of range")
+			}
+			out = append(out, old[offset:offset+length]...)
+
+		case blockPatchOpInsert:
+			if read+4 > len(patch) {
+				return nil, fmt.Errorf("eszip: truncated insert instruction in patch")
+			}
+			length := binary.BigEndian.Uint32(patch[read : read+4])
+			read += 4
+			if uint64(read)+uint64(length) > uint64(len(patch)) {
+				return nil, fmt.Errorf("eszip: truncated insert payload in patch")
+			}
+			out = append(out, patch[read:read+int(length)]...)
+			read += int(length)
+
+		default:
+			return nil, fmt.Errorf("eszip: unknown patch opcode %d", op)
+		}
+	}
+
+	return out, nil
+}
@@ -0,0 +1,203 @@
+// Copyright 2018-2024 the Deno authors. All rights reserved. MIT license.
+
+package eszip
+
+import "encoding/binary"
+
+// Content-defined chunking splits each module's source into variable-length
+// chunks so identical chunks -- e.g. shared code across multiple versions of
+// the same npm package -- are stored once in the chunks section instead of
+// once per module. It is opt-in via Options.Chunking / EszipV2.SetChunking;
+// archives written without it are unaffected.
+const (
+	chunkTargetSize = 64 * 1024
+	chunkMinSize    = 16 * 1024
+	chunkMaxSize    = 256 * 1024
+)
+
+// chunkMask selects chunk boundaries: once a chunk has reached
+// chunkMinSize, a boundary falls wherever h&chunkMask == 0, which for
+// uniformly distributed hash values happens at one position in
+// chunkMask+1 (chunkTargetSize).
+const chunkMask = uint64(chunkTargetSize - 1)
+
+// splitContentDefined breaks data into variable-length chunks: a boundary
+// falls wherever the trailing bits of h are all zero, where h folds in
+// every byte since the previous boundary (rotate left by one, XOR the byte)
+// and is reset at each boundary. h is not a sliding-window hash, so
+// inserting or deleting bytes moves every later boundary too, and chunks
+// after an edit are not shared with the unedited source; chunks are shared
+// where two sources agree from a common boundary on, e.g. a common prefix.
+// Chunk sizes are clamped to [chunkMinSize, chunkMaxSize].
+func splitContentDefined(data []byte) [][]byte {
+	if len(data) == 0 {
+		return nil
+	}
+	if len(data) <= chunkMinSize {
+		return [][]byte{data}
+	}
+
+	var chunks [][]byte
+	start := 0
+	var h uint64
+	for i, b := range data {
+		h = (h << 1) ^ uint64(b) ^ (h >> 63)
+		size := i + 1 - start
+		if (size >= chunkMinSize && h&chunkMask == 0) || size >= chunkMaxSize {
+			chunks = append(chunks, data[start:i+1])
+			start = i + 1
+			h = 0
+		}
+	}
+	if start < len(data) {
+		chunks = append(chunks, data[start:])
+	}
+	return chunks
+}
+
+// chunkBuilder accumulates unique, on-disk (compressed) chunks while
+// IntoBytes walks the module map, deduplicating identical chunks across
+// every module added so far.
+type chunkBuilder struct {
+	checksum    ChecksumType
+	compression CompressionType
+	dedup       map[string]uint32
+	payloads    [][]byte
+	index       []uint32
+}
+
+func newChunkBuilder(checksum ChecksumType, compression CompressionType) *chunkBuilder {
+	return &chunkBuilder{checksum: checksum, compression: compression, dedup: make(map[string]uint32)}
+}
+
+// addSource splits data into content-defined chunks and appends their IDs
+// (assigning new ones for chunks not seen before) to the flat chunk-index
+// table, returning the (chunkIndexOffset, chunkCount) pair that identifies
+// this module's slice of that table.
+func (b *chunkBuilder) addSource(data []byte) (uint32, uint32, error) {
+	chunks := splitContentDefined(data)
+	offset := uint32(len(b.index))
+
+	for _, chunk := range chunks {
+		key := string(chunk)
+		id, ok := b.dedup[key]
+		if !ok {
+			onDisk, err := b.compression.Compress(chunk)
+			if err != nil {
+				return 0, 0, err
+			}
+			id = uint32(len(b.payloads))
+			b.payloads = append(b.payloads, onDisk)
+			b.dedup[key] = id
+		}
+		b.index = append(b.index, id)
+	}
+
+	return offset, uint32(len(chunks)), nil
+}
+
+// build lays out the chunks section: the flat chunk-index table, followed by
+// the unique chunk payloads (each length-prefixed and hashed) in chunkID
+// order.
+func (b *chunkBuilder) build() []byte {
+	var section []byte
+	section = appendU32BE(section, uint32(len(b.index)))
+	for _, id := range b.index {
+		section = appendU32BE(section, id)
+	}
+
+	section = appendU32BE(section, uint32(len(b.payloads)))
+	for _, payload := range b.payloads {
+		section = appendU32BE(section, uint32(len(payload)))
+		section = append(section, payload...)
+		section = append(section, b.checksum.Hash(payload)...)
+	}
+
+	return section
+}
+
+// chunkStore is the read-side counterpart of chunkBuilder: the decoded,
+// verified, decompressed chunk payloads plus the flat chunk-index table,
+// ready for a module to assemble its source from a (chunkIndexOffset,
+// chunkCount) pair.
+type chunkStore struct {
+	index   []uint32
+	payload [][]byte
+}
+
+// assemble concatenates the chunkCount payloads starting at chunkIndexOffset
+// in the chunk-index table, reconstructing one module's source bytes.
+func (c *chunkStore) assemble(chunkIndexOffset, chunkCount uint32) ([]byte, error) {
+	if int64(chunkIndexOffset)+int64(chunkCount) > int64(len(c.index)) {
+		return nil, errInvalidV2SourceOffset(int(chunkIndexOffset))
+	}
+
+	var buf []byte
+	for i := uint32(0); i < chunkCount; i++ {
+		chunkID := c.index[chunkIndexOffset+i]
+		if int(chunkID) >= len(c.payload) {
+			return nil, errInvalidV2SourceOffset(int(chunkID))
+		}
+		buf = append(buf, c.payload[chunkID]...)
+	}
+	return buf, nil
+}
+
+// decodeChunksSection parses an already-read, checksum-verified chunks
+// section body into a chunkStore, decompressing and verifying every chunk
+// payload against options.
+func decodeChunksSection(content []byte, options Options) (*chunkStore, error) {
+	pos := 0
+	readU32 := func() (uint32, error) {
+		if pos+4 > len(content) {
+			return 0, errInvalidV2Header("chunks section")
+		}
+		v := binary.BigEndian.Uint32(content[pos : pos+4])
+		pos += 4
+		return v, nil
+	}
+
+	indexCount, err := readU32()
+	if err != nil {
+		return nil, err
+	}
+	index := make([]uint32, indexCount)
+	for i := range index {
+		if index[i], err = readU32(); err != nil {
+			return nil, err
+		}
+	}
+
+	chunkCount, err := readU32()
+	if err != nil {
+		return nil, err
+	}
+
+	checksumSize := int(options.GetChecksumSize())
+	payload := make([][]byte, chunkCount)
+	for i := range payload {
+		chunkLen, err := readU32()
+		if err != nil {
+			return nil, err
+		}
+		if pos+int(chunkLen)+checksumSize > len(content) {
+			return nil, errInvalidV2Header("chunk payload")
+		}
+		raw := content[pos : pos+int(chunkLen)]
+		pos += int(chunkLen)
+		hash := content[pos : pos+checksumSize]
+		pos += checksumSize
+
+		if !options.Checksum.Verify(raw, hash) {
+			return nil, errInvalidV2SourceHash("")
+		}
+
+		decompressed, err := options.Compression.Decompress(raw)
+		if err != nil {
+			return nil, err
+		}
+		payload[i] = decompressed
+	}
+
+	return &chunkStore{index: index, payload: payload}, nil
+}
@@ -0,0 +1,543 @@
+// Copyright 2018-2024 the Deno authors. All rights reserved. MIT license.
+
+package eszip
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// MagicDiff identifies a binary delta produced by DiffArchives.
+var MagicDiff = [8]byte{'E', 'S', 'Z', 'D', 'I', 'F', 'F', '1'}
+
+// DiffOp selects how a ModuleDelta's Payload should be interpreted.
+type DiffOp uint8
+
+const (
+	// DiffOpFullReplace stores the module's new source verbatim in
+	// Payload.
+	DiffOpFullReplace DiffOp = 0
+	// DiffOpBlockPatch stores a copy/insert instruction stream (see
+	// encodeBlockPatch) that reconstructs the new source from the old
+	// one. Only ever chosen when it's smaller than the full source, and
+	// only when a checksum is available to verify the result (see
+	// DiffArchives).
+	DiffOpBlockPatch DiffOp = 1
+)
+
+// ModuleDelta describes one added or changed module in an ArchiveDelta.
+type ModuleDelta struct {
+	Specifier string
+	Kind      ModuleKind
+	Op        DiffOp
+	Payload   []byte
+
+	// ExpectedHash is Checksum.Hash of the module's new source, recorded
+	// for Changed entries only (Added entries never carry one). It's nil
+	// when the delta's Checksum is ChecksumNone, in which case Op is
+	// always DiffOpFullReplace -- a block patch can't safely be applied
+	// without something to verify the reconstruction against.
+	ExpectedHash []byte
+
+	// SourceMap is the module's new source map, stored in full, or nil
+	// if it has none.
+	SourceMap []byte
+}
+
+// ArchiveDelta is a patch between two eszip archives, produced by
+// DiffArchives and consumed by ApplyPatch, that's typically much smaller
+// than the new archive itself when the two only differ in a handful of
+// modules.
+type ArchiveDelta struct {
+	// Checksum is the new archive's configured checksum algorithm, reused
+	// to verify patched modules on apply.
+	Checksum ChecksumType
+
+	RemovedSpecifiers []string
+	Added             []ModuleDelta
+	Changed           []ModuleDelta
+
+	RemovedRedirects []string
+	AddedRedirects   map[string]string
+
+	// NpmSnapshotJSON holds the new archive's npm snapshot as compact JSON
+	// (json.Marshal; WriteAsTar's npm-snapshot.json sidecar holds the same
+	// fields, indented), or nil if the snapshot is unchanged.
+	NpmSnapshotJSON []byte
+}
+
+// DiffArchives compares oldArchive against newArchive and returns the delta
+// needed to turn the former into the latter. Both sides must be V2
+// archives, since only V2 has a configurable ChecksumType and redirects.
+func DiffArchives(ctx context.Context, oldArchive, newArchive *EszipUnion) (*ArchiveDelta, error) {
+	if !oldArchive.IsV2() || !newArchive.IsV2() {
+		return nil, fmt.Errorf("eszip: diff requires both archives to be V2")
+	}
+	checksum := newArchive.V2().Options().Checksum
+	oldRedirects := oldArchive.V2().Redirects()
+	newRedirects := newArchive.V2().Redirects()
+
+	// Specifiers() includes redirect entries, which are diffed separately
+	// below (and whose GetModule already resolves to their target's
+	// module) -- exclude them here so a redirect doesn't also show up as
+	// an added/removed/changed module.
+	oldSpecifiers := make(map[string]bool)
+	for _, spec := range oldArchive.Specifiers() {
+		if _, isRedirect := oldRedirects[spec]; !isRedirect {
+			oldSpecifiers[spec] = true
+		}
+	}
+	newSpecifiers := make(map[string]bool)
+	for _, spec := range newArchive.Specifiers() {
+		if _, isRedirect := newRedirects[spec]; !isRedirect {
+			newSpecifiers[spec] = true
+		}
+	}
+
+	delta := &ArchiveDelta{Checksum: checksum, AddedRedirects: map[string]string{}}
+
+	for spec := range oldSpecifiers {
+		if !newSpecifiers[spec] {
+			delta.RemovedSpecifiers = append(delta.RemovedSpecifiers, spec)
+		}
+	}
+	sort.Strings(delta.RemovedSpecifiers)
+
+	for spec := range newSpecifiers {
+		newModule := newArchive.GetModule(spec)
+		if newModule == nil {
+			continue // Npm specifier; handled elsewhere.
+		}
+
+		newSource, err := newModule.Source(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("eszip: reading new source for %s: %w", spec, err)
+		}
+		newSourceMap, err := newModule.SourceMap(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("eszip: reading new source map for %s: %w", spec, err)
+		}
+
+		oldModule := oldArchive.GetModule(spec)
+		if oldModule == nil {
+			delta.Added = append(delta.Added, ModuleDelta{
+				Specifier: spec,
+				Kind:      newModule.Kind,
+				Op:        DiffOpFullReplace,
+				Payload:   newSource,
+				SourceMap: newSourceMap,
+			})
+			continue
+		}
+
+		oldSource, err := oldModule.Source(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("eszip: reading old source for %s: %w", spec, err)
+		}
+		if bytes.Equal(oldSource, newSource) && oldModule.Kind == newModule.Kind {
+			continue
+		}
+
+		md := ModuleDelta{Specifier: spec, Kind: newModule.Kind, SourceMap: newSourceMap}
+		if checksum != ChecksumNone {
+			patch := encodeBlockPatch(oldSource, newSource)
+			if len(patch) < len(newSource) {
+				md.Op = DiffOpBlockPatch
+				md.Payload = patch
+			} else {
+				md.Op = DiffOpFullReplace
+				md.Payload = newSource
+			}
+			md.ExpectedHash = checksum.Hash(newSource)
+		} else {
+			md.Op = DiffOpFullReplace
+			md.Payload = newSource
+		}
+		delta.Changed = append(delta.Changed, md)
+	}
+
+	sort.Slice(delta.Added, func(i, j int) bool { return delta.Added[i].Specifier < delta.Added[j].Specifier })
+	sort.Slice(delta.Changed, func(i, j int) bool { return delta.Changed[i].Specifier < delta.Changed[j].Specifier })
+
+	for spec, target := range oldRedirects {
+		if newTarget, ok := newRedirects[spec]; !ok || newTarget != target {
+			if _, stillRedirect := newRedirects[spec]; !stillRedirect {
+				delta.RemovedRedirects = append(delta.RemovedRedirects, spec)
+			}
+		}
+	}
+	sort.Strings(delta.RemovedRedirects)
+	for spec, target := range newRedirects {
+		if oldRedirects[spec] != target {
+			delta.AddedRedirects[spec] = target
+		}
+	}
+
+	oldNpmJSON, err := json.Marshal(oldArchive.V2().NpmSnapshot())
+	if err != nil {
+		return nil, fmt.Errorf("eszip: marshaling old npm snapshot: %w", err)
+	}
+	newNpmJSON, err := json.Marshal(newArchive.V2().NpmSnapshot())
+	if err != nil {
+		return nil, fmt.Errorf("eszip: marshaling new npm snapshot: %w", err)
+	}
+	if !bytes.Equal(oldNpmJSON, newNpmJSON) {
+		delta.NpmSnapshotJSON = newNpmJSON
+	}
+
+	return delta, nil
+}
+
+// ApplyPatch reconstructs the new archive that delta was diffed against,
+// starting from base. base must be the same archive (or at least the same
+// specifiers/content) that DiffArchives was called with as oldArchive.
+func ApplyPatch(ctx context.Context, base *EszipUnion, delta *ArchiveDelta) (*EszipV2, error) {
+	if !base.IsV2() {
+		return nil, fmt.Errorf("eszip: patch requires a V2 base archive")
+	}
+
+	out := NewV2()
+	out.SetChecksum(base.V2().Options().Checksum)
+	out.SetCompression(base.V2().Options().Compression)
+
+	removed := make(map[string]bool, len(delta.RemovedSpecifiers))
+	for _, spec := range delta.RemovedSpecifiers {
+		removed[spec] = true
+	}
+	changed := make(map[string]ModuleDelta, len(delta.Changed))
+	for _, md := range delta.Changed {
+		changed[md.Specifier] = md
+	}
+
+	baseRedirects := base.V2().Redirects()
+	for _, spec := range base.Specifiers() {
+		if removed[spec] {
+			continue
+		}
+		// Redirects are carried over separately below; GetModule would
+		// otherwise resolve them to their target's module.
+		if _, isRedirect := baseRedirects[spec]; isRedirect {
+			continue
+		}
+		module := base.GetModule(spec)
+		if module == nil {
+			continue
+		}
+
+		if md, ok := changed[spec]; ok {
+			newSource, err := reconstructModule(ctx, module, md, delta.Checksum)
+			if err != nil {
+				return nil, fmt.Errorf("eszip: patching %s: %w", spec, err)
+			}
+			out.AddModule(spec, md.Kind, newSource, md.SourceMap)
+			continue
+		}
+
+		source, err := module.Source(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("eszip: reading base source for %s: %w", spec, err)
+		}
+		sourceMap, err := module.SourceMap(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("eszip: reading base source map for %s: %w", spec, err)
+		}
+		out.AddModule(spec, module.Kind, source, sourceMap)
+	}
+
+	for _, md := range delta.Added {
+		out.AddModule(md.Specifier, md.Kind, md.Payload, md.SourceMap)
+	}
+
+	removedRedirects := make(map[string]bool, len(delta.RemovedRedirects))
+	for _, spec := range delta.RemovedRedirects {
+		removedRedirects[spec] = true
+	}
+	for spec, target := range base.V2().Redirects() {
+		if !removedRedirects[spec] {
+			if _, overridden := delta.AddedRedirects[spec]; !overridden {
+				out.AddRedirect(spec, target)
+			}
+		}
+	}
+	for spec, target := range delta.AddedRedirects {
+		out.AddRedirect(spec, target)
+	}
+
+	if delta.NpmSnapshotJSON != nil {
+		var snapshot NpmResolutionSnapshot
+		if err := json.Unmarshal(delta.NpmSnapshotJSON, &snapshot); err != nil {
+			return nil, fmt.Errorf("eszip: unmarshaling patched npm snapshot: %w", err)
+		}
+		out.npmSnapshot = &snapshot
+	} else if snapshot := base.V2().NpmSnapshot(); snapshot != nil {
+		out.npmSnapshot = snapshot
+	}
+
+	return out, nil
+}
+
+// reconstructModule produces a changed module's new source, either by
+// taking it verbatim (DiffOpFullReplace) or replaying a block patch
+// against the base module's current source (DiffOpBlockPatch), then
+// verifying the result against ExpectedHash when one was recorded. A
+// block patch is never applied without a hash to verify it against (see
+// DiffArchives), but a full replacement is accepted unverified when the
+// delta carries no checksum at all.
+func reconstructModule(ctx context.Context, base *Module, md ModuleDelta, checksum ChecksumType) ([]byte, error) {
+	var newSource []byte
+
+	switch md.Op {
+	case DiffOpFullReplace:
+		newSource = md.Payload
+	case DiffOpBlockPatch:
+		oldSource, err := base.Source(ctx)
+		if err != nil {
+			return nil, err
+		}
+		newSource, err = applyBlockPatch(oldSource, md.Payload)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown diff op %d", md.Op)
+	}
+
+	if md.ExpectedHash != nil && !checksum.Verify(newSource, md.ExpectedHash) {
+		return nil, fmt.Errorf("patched source does not match expected hash")
+	}
+	return newSource, nil
+}
+
+// IntoBytes serializes the delta to its binary wire format.
+func (d *ArchiveDelta) IntoBytes() ([]byte, error) {
+	var buf []byte
+	buf = append(buf, MagicDiff[:]...)
+	buf = append(buf, byte(d.Checksum))
+
+	buf = appendU32BE(buf, uint32(len(d.RemovedSpecifiers)))
+	for _, spec := range d.RemovedSpecifiers {
+		appendString(&buf, spec)
+	}
+
+	buf = appendU32BE(buf, uint32(len(d.Added)))
+	for _, md := range d.Added {
+		appendModuleDelta(&buf, md, false)
+	}
+
+	buf = appendU32BE(buf, uint32(len(d.Changed)))
+	for _, md := range d.Changed {
+		appendModuleDelta(&buf, md, true)
+	}
+
+	buf = appendU32BE(buf, uint32(len(d.RemovedRedirects)))
+	for _, spec := range d.RemovedRedirects {
+		appendString(&buf, spec)
+	}
+
+	buf = appendU32BE(buf, uint32(len(d.AddedRedirects)))
+	redirectSpecs := make([]string, 0, len(d.AddedRedirects))
+	for spec := range d.AddedRedirects {
+		redirectSpecs = append(redirectSpecs, spec)
+	}
+	sort.Strings(redirectSpecs)
+	for _, spec := range redirectSpecs {
+		appendString(&buf, spec)
+		appendString(&buf, d.AddedRedirects[spec])
+	}
+
+	if d.NpmSnapshotJSON != nil {
+		buf = append(buf, 1)
+		appendBytes(&buf, d.NpmSnapshotJSON)
+	} else {
+		buf = append(buf, 0)
+	}
+
+	return buf, nil
+}
+
+func appendModuleDelta(buf *[]byte, md ModuleDelta, withOp bool) {
+	appendString(buf, md.Specifier)
+	*buf = append(*buf, byte(md.Kind))
+	if withOp {
+		*buf = append(*buf, byte(md.Op))
+		appendBytes(buf, md.ExpectedHash)
+	}
+	appendBytes(buf, md.Payload)
+	if md.SourceMap != nil {
+		*buf = append(*buf, 1)
+		appendBytes(buf, md.SourceMap)
+	} else {
+		*buf = append(*buf, 0)
+	}
+}
+
+func appendBytes(buf *[]byte, b []byte) {
+	*buf = appendU32BE(*buf, uint32(len(b)))
+	*buf = append(*buf, b...)
+}
+
+// ParseArchiveDelta parses a delta previously produced by
+// ArchiveDelta.IntoBytes.
+func ParseArchiveDelta(data []byte) (*ArchiveDelta, error) {
+	if len(data) < 9 || !bytes.Equal(data[:8], MagicDiff[:]) {
+		return nil, errInvalidV2Header("delta magic")
+	}
+
+	d := &ArchiveDelta{Checksum: ChecksumType(data[8]), AddedRedirects: map[string]string{}}
+	read := 9
+
+	readU32 := func() (uint32, error) {
+		if read+4 > len(data) {
+			return 0, errInvalidV2Header("delta: truncated length")
+		}
+		v := binary.BigEndian.Uint32(data[read : read+4])
+		read += 4
+		return v, nil
+	}
+	readString := func() (string, error) {
+		n, err := readU32()
+		if err != nil {
+			return "", err
+		}
+		if read+int(n) > len(data) {
+			return "", errInvalidV2Header("delta: truncated string")
+		}
+		s := string(data[read : read+int(n)])
+		read += int(n)
+		return s, nil
+	}
+	readBytes := func() ([]byte, error) {
+		n, err := readU32()
+		if err != nil {
+			return nil, err
+		}
+		if read+int(n) > len(data) {
+			return nil, errInvalidV2Header("delta: truncated bytes")
+		}
+		b := data[read : read+int(n)]
+		read += int(n)
+		if n == 0 {
+			return nil, nil
+		}
+		return b, nil
+	}
+	readModuleDelta := func(withOp bool) (ModuleDelta, error) {
+		var md ModuleDelta
+		var err error
+		if md.Specifier, err = readString(); err != nil {
+			return md, err
+		}
+		if read >= len(data) {
+			return md, errInvalidV2Header("delta: truncated kind")
+		}
+		md.Kind = ModuleKind(data[read])
+		read++
+		if withOp {
+			if read >= len(data) {
+				return md, errInvalidV2Header("delta: truncated op")
+			}
+			md.Op = DiffOp(data[read])
+			read++
+			if md.ExpectedHash, err = readBytes(); err != nil {
+				return md, err
+			}
+		}
+		if md.Payload, err = readBytes(); err != nil {
+			return md, err
+		}
+		if read >= len(data) {
+			return md, errInvalidV2Header("delta: truncated source map flag")
+		}
+		hasSourceMap := data[read]
+		read++
+		if hasSourceMap != 0 {
+			if md.SourceMap, err = readBytes(); err != nil {
+				return md, err
+			}
+		}
+		return md, nil
+	}
+
+	removedCount, err := readU32()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint32(0); i < removedCount; i++ {
+		spec, err := readString()
+		if err != nil {
+			return nil, err
+		}
+		d.RemovedSpecifiers = append(d.RemovedSpecifiers, spec)
+	}
+
+	addedCount, err := readU32()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint32(0); i < addedCount; i++ {
+		md, err := readModuleDelta(false)
+		if err != nil {
+			return nil, err
+		}
+		d.Added = append(d.Added, md)
+	}
+
+	changedCount, err := readU32()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint32(0); i < changedCount; i++ {
+		md, err := readModuleDelta(true)
+		if err != nil {
+			return nil, err
+		}
+		d.Changed = append(d.Changed, md)
+	}
+
+	removedRedirectCount, err := readU32()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint32(0); i < removedRedirectCount; i++ {
+		spec, err := readString()
+		if err != nil {
+			return nil, err
+		}
+		d.RemovedRedirects = append(d.RemovedRedirects, spec)
+	}
+
+	addedRedirectCount, err := readU32()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint32(0); i < addedRedirectCount; i++ {
+		spec, err := readString()
+		if err != nil {
+			return nil, err
+		}
+		target, err := readString()
+		if err != nil {
+			return nil, err
+		}
+		d.AddedRedirects[spec] = target
+	}
+
+	if read >= len(data) {
+		return nil, errInvalidV2Header("delta: truncated npm flag")
+	}
+	hasNpmSnapshot := data[read]
+	read++
+	if hasNpmSnapshot != 0 {
+		npmJSON, err := readBytes()
+		if err != nil {
+			return nil, err
+		}
+		d.NpmSnapshotJSON = npmJSON
+	}
+
+	return d, nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2018-2024 the Deno authors. All rights reserved. MIT license.
+
+package eszip
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func mustParseBytes(t *testing.T, e *EszipV2) *EszipUnion {
+	t.Helper()
+	data, err := e.IntoBytes()
+	if err != nil {
+		t.Fatalf("failed to serialize archive: %v", err)
+	}
+	union, err := ParseBytes(context.Background(), data)
+	if err != nil {
+		t.Fatalf("failed to parse archive: %v", err)
+	}
+	return union
+}
+
+func TestDiffAndApplyPatchRoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	oldEszip := NewV2()
+	oldEszip.AddModule("file:///unchanged.js", ModuleKindJavaScript, []byte("export const u = 1;"), nil)
+	oldEszip.AddModule("file:///changed.js", ModuleKindJavaScript, []byte("export function greet() { return 'hello world, this file has a lot of unchanged boilerplate around one small edit'; }"), nil)
+	oldEszip.AddModule("file:///removed.js", ModuleKindJavaScript, []byte("export const gone = true;"), nil)
+	oldEszip.AddRedirect("file:///old-redirect.js", "file:///unchanged.js")
+	oldArchive := mustParseBytes(t, oldEszip)
+
+	newEszip := NewV2()
+	newEszip.SetChecksum(ChecksumSha256)
+	newEszip.AddModule("file:///unchanged.js", ModuleKindJavaScript, []byte("export const u = 1;"), nil)
+	newEszip.AddModule("file:///changed.js", ModuleKindJavaScript, []byte("export function greet() { return 'goodbye world, this file has a lot of unchanged boilerplate around one small edit'; }"), nil)
+	newEszip.AddModule("file:///added.js", ModuleKindJavaScript, []byte("export const brandNew = 42;"), nil)
+	newEszip.AddRedirect("file:///new-redirect.js", "file:///added.js")
+	newArchive := mustParseBytes(t, newEszip)
+
+	delta, err := DiffArchives(ctx, oldArchive, newArchive)
+	if err != nil {
+		t.Fatalf("failed to diff archives: %v", err)
+	}
+	if len(delta.Added) != 1 || delta.Added[0].Specifier != "file:///added.js" {
+		t.Errorf("expected one added module (added.js), got %+v", delta.Added)
+	}
+	if len(delta.Changed) != 1 || delta.Changed[0].Specifier != "file:///changed.js" {
+		t.Errorf("expected one changed module (changed.js), got %+v", delta.Changed)
+	}
+	if delta.Changed[0].Op != DiffOpBlockPatch {
+		t.Errorf("expected changed.js to use a block patch given its small edit, got op %d", delta.Changed[0].Op)
+	}
+	if len(delta.RemovedSpecifiers) != 1 || delta.RemovedSpecifiers[0] != "file:///removed.js" {
+		t.Errorf("expected one removed module (removed.js), got %v", delta.RemovedSpecifiers)
+	}
+	if len(delta.RemovedRedirects) != 1 || delta.RemovedRedirects[0] != "file:///old-redirect.js" {
+		t.Errorf("expected old-redirect.js to be removed, got %v", delta.RemovedRedirects)
+	}
+	if delta.AddedRedirects["file:///new-redirect.js"] != "file:///added.js" {
+		t.Errorf("expected new-redirect.js to be added, got %v", delta.AddedRedirects)
+	}
+
+	serialized, err := delta.IntoBytes()
+	if err != nil {
+		t.Fatalf("failed to serialize delta: %v", err)
+	}
+	parsedDelta, err := ParseArchiveDelta(serialized)
+	if err != nil {
+		t.Fatalf("failed to parse delta: %v", err)
+	}
+
+	patched, err := ApplyPatch(ctx, oldArchive, parsedDelta)
+	if err != nil {
+		t.Fatalf("failed to apply patch: %v", err)
+	}
+	patchedUnion := mustParseBytes(t, patched)
+
+	for _, spec := range newArchive.Specifiers() {
+		wantModule := newArchive.GetModule(spec)
+		if wantModule == nil {
+			continue
+		}
+		gotModule := patchedUnion.GetModule(spec)
+		if gotModule == nil {
+			t.Fatalf("expected patched archive to contain %s", spec)
+		}
+		want, err := wantModule.Source(ctx)
+		if err != nil {
+			t.Fatalf("failed to read expected source for %s: %v", spec, err)
+		}
+		got, err := gotModule.Source(ctx)
+		if err != nil {
+			t.Fatalf("failed to read patched source for %s: %v", spec, err)
+		}
+		if !bytes.Equal(want, got) {
+			t.Errorf("source mismatch for %s:\nwant: %s\ngot:  %s", spec, want, got)
+		}
+	}
+
+	if _, ok := patchedUnion.V2().Redirects()["file:///old-redirect.js"]; ok {
+		t.Errorf("expected old-redirect.js to be gone from the patched archive")
+	}
+	if target, ok := patchedUnion.V2().Redirects()["file:///new-redirect.js"]; !ok || target != "file:///added.js" {
+		t.Errorf("expected new-redirect.js -> added.js in the patched archive, got %q", target)
+	}
+
+	if patchedModule := patchedUnion.GetModule("file:///removed.js"); patchedModule != nil {
+		t.Errorf("expected removed.js to be gone from the patched archive")
+	}
+}
+
+func TestBlockPatchRoundTrip(t *testing.T) {
+	old := []byte("the quick brown fox jumps over the lazy dog, repeated for good measure: the quick brown fox jumps over the lazy dog")
+	new := []byte("the quick brown fox leaps over the lazy dog, repeated for good measure: the quick brown fox jumps over the lazy dog")
+
+	patch := encodeBlockPatch(old, new)
+	if len(patch) >= len(new) {
+		t.Errorf("expected block patch (%d bytes) to be smaller than the full new content (%d bytes)", len(patch), len(new))
+	}
+
+	got, err := applyBlockPatch(old, patch)
+	if err != nil {
+		t.Fatalf("failed to apply block patch: %v", err)
+	}
+	if !bytes.Equal(got, new) {
+		t.Errorf("block patch round trip mismatch:\nwant: %s\ngot:  %s", new, got)
+	}
+}
+
+func TestDiffRequiresV2Archives(t *testing.T) {
+	ctx := context.Background()
+	v2Archive := mustParseBytes(t, NewV2())
+
+	v1JSON := []byte(`{
+		"version": 1,
+		"modules": {
+			"file:///a.js": {"Source": {"source": "export const a = 1;", "deps": []}}
+		}
+	}`)
+	v1Archive, err := ParseBytes(ctx, v1JSON)
+	if err != nil {
+		t.Fatalf("failed to parse v1 archive: %v", err)
+	}
+	if !v1Archive.IsV1() {
+		t.Fatalf("expected a V1 archive")
+	}
+
+	if _, err := DiffArchives(ctx, v1Archive, v2Archive); err == nil {
+		t.Errorf("expected DiffArchives to reject a V1 old archive")
+	}
+}
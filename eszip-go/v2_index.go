@@ -0,0 +1,228 @@
+// Copyright 2018-2024 the Deno authors. All rights reserved. MIT license.
+
+package eszip
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+// indexHeaderEntry is a single (specifier, encoded entry) pair waiting to
+// be laid out into either the legacy linear modules header or the sorted
+// index format, depending on the version being written.
+type indexHeaderEntry struct {
+	specifier string
+	encoded   []byte
+}
+
+// encodeLinearModulesHeader lays out entries as specifier-prefixed records,
+// one after another, matching every version prior to VersionV2_5.
+func encodeLinearModulesHeader(entries []indexHeaderEntry) []byte {
+	var header []byte
+	for _, e := range entries {
+		appendString(&header, e.specifier)
+		header = append(header, e.encoded...)
+	}
+	return header
+}
+
+// encodeIndexedModulesHeader lays out entries as a VersionV2_5 modules
+// header: a string blob holding every specifier (uvarint-length prefixed)
+// followed by a sorted array of (specifierOffset, entryOffset) records and
+// the entry region itself. Sorting by specifier lets readers binary search
+// the index instead of scanning every entry.
+func encodeIndexedModulesHeader(entries []indexHeaderEntry) []byte {
+	sorted := make([]indexHeaderEntry, len(entries))
+	copy(sorted, entries)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].specifier < sorted[j].specifier
+	})
+
+	var stringBlob, entryRegion []byte
+	stringOffsets := make([]uint32, len(sorted))
+	entryOffsets := make([]uint32, len(sorted))
+
+	for i, e := range sorted {
+		stringOffsets[i] = uint32(len(stringBlob))
+		stringBlob = appendUvarintString(stringBlob, e.specifier)
+
+		entryOffsets[i] = uint32(len(entryRegion))
+		entryRegion = append(entryRegion, e.encoded...)
+	}
+
+	var header []byte
+	header = appendU32BE(header, uint32(len(stringBlob)))
+	header = append(header, stringBlob...)
+	header = appendU32BE(header, uint32(len(sorted)))
+	for i := range sorted {
+		header = appendU32BE(header, stringOffsets[i])
+		header = appendU32BE(header, entryOffsets[i])
+	}
+	header = append(header, entryRegion...)
+	return header
+}
+
+// parseModulesHeaderV3 parses a VersionV2_5 modules header without decoding
+// every entry: it walks the sorted index to learn each specifier, peeking
+// only the one-byte entry kind (entryKindAt) to tell an npm specifier apart
+// from a module or redirect -- npm specifiers are few and decoded eagerly
+// into npmSpecifiers, but every module/redirect entry is left for
+// ModuleMap.Get to binary-search and decode lazily via index.Get. The
+// resulting ModuleMap therefore iterates in specifier-sorted order rather
+// than insertion order.
+func parseModulesHeaderV3(content []byte, supportsNpm, supportsCompression bool) (*ModuleMap, map[string]NpmPackageIndex, error) {
+	index, err := ParseModulesIndex(content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	modules := NewModuleMap()
+	modules.prepareLazy(index, supportsNpm, supportsCompression)
+	npmSpecifiers := make(map[string]NpmPackageIndex)
+
+	for i := 0; i < index.Len(); i++ {
+		specifier, err := index.specifierAt(i)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		kind, err := index.entryKindAt(i)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if kind == entryKindNpmSpecifier {
+			_, npmIdx, _, err := index.decodeEntryAt(i, specifier, supportsNpm, supportsCompression)
+			if err != nil {
+				return nil, nil, err
+			}
+			npmSpecifiers[specifier] = *npmIdx
+			continue
+		}
+
+		modules.registerLazy(specifier)
+	}
+
+	return modules, npmSpecifiers, nil
+}
+
+// ModulesIndex is a read-only view over a VersionV2_5 modules header that
+// supports O(log n) lookup by specifier without decoding every entry.
+type ModulesIndex struct {
+	stringBlob  []byte
+	entryRegion []byte
+	// offsets holds (stringOffset, entryOffset) pairs, sorted by the
+	// specifier each stringOffset points at.
+	offsets []uint32
+}
+
+// ParseModulesIndex parses the string blob and sorted index of a
+// VersionV2_5 modules header (without decoding the entry region).
+func ParseModulesIndex(content []byte) (*ModulesIndex, error) {
+	if len(content) < 4 {
+		return nil, errInvalidV2Header("modules index: string blob len")
+	}
+	blobLen := binary.BigEndian.Uint32(content[:4])
+	offset := 4 + int(blobLen)
+	if offset > len(content) {
+		return nil, errInvalidV2Header("modules index: string blob")
+	}
+	stringBlob := content[4:offset]
+
+	if offset+4 > len(content) {
+		return nil, errInvalidV2Header("modules index: count")
+	}
+	count := int(binary.BigEndian.Uint32(content[offset : offset+4]))
+	offset += 4
+
+	indexEnd := offset + count*8
+	if indexEnd > len(content) {
+		return nil, errInvalidV2Header("modules index: index array")
+	}
+
+	offsets := make([]uint32, count*2)
+	for i := 0; i < count; i++ {
+		base := offset + i*8
+		offsets[i*2] = binary.BigEndian.Uint32(content[base : base+4])
+		offsets[i*2+1] = binary.BigEndian.Uint32(content[base+4 : base+8])
+	}
+
+	return &ModulesIndex{
+		stringBlob:  stringBlob,
+		entryRegion: content[indexEnd:],
+		offsets:     offsets,
+	}, nil
+}
+
+// Len returns the number of entries in the index.
+func (idx *ModulesIndex) Len() int {
+	return len(idx.offsets) / 2
+}
+
+func (idx *ModulesIndex) specifierAt(i int) (string, error) {
+	s, _, err := readUvarintString(idx.stringBlob, int(idx.offsets[i*2]))
+	return s, err
+}
+
+func (idx *ModulesIndex) decodeEntryAt(i int, specifier string, supportsNpm, supportsCompression bool) (EszipV2Module, *NpmPackageIndex, int, error) {
+	return decodeModuleEntry(idx.entryRegion, int(idx.offsets[i*2+1]), specifier, supportsNpm, supportsCompression)
+}
+
+// entryKindAt peeks the one-byte entry kind of entry i without decoding the
+// rest of it, so callers can tell an npm specifier apart from a module or
+// redirect for the cost of a single byte read.
+func (idx *ModulesIndex) entryKindAt(i int) (byte, error) {
+	offset := int(idx.offsets[i*2+1])
+	if offset >= len(idx.entryRegion) {
+		return 0, errInvalidV2Header("modules index: entry kind")
+	}
+	return idx.entryRegion[offset], nil
+}
+
+// Get performs a binary search over the sorted index and, on a match,
+// decodes just that one entry. It returns ok=false if the specifier is not
+// present, and npmIdx non-nil if the match is a root npm specifier rather
+// than a module or redirect.
+func (idx *ModulesIndex) Get(specifier string, supportsNpm, supportsCompression bool) (mod EszipV2Module, npmIdx *NpmPackageIndex, ok bool, err error) {
+	n := idx.Len()
+	i := sort.Search(n, func(i int) bool {
+		s, _ := idx.specifierAt(i)
+		return s >= specifier
+	})
+	if i >= n {
+		return nil, nil, false, nil
+	}
+	s, err := idx.specifierAt(i)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if s != specifier {
+		return nil, nil, false, nil
+	}
+
+	mod, npmIdx, _, err = idx.decodeEntryAt(i, specifier, supportsNpm, supportsCompression)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return mod, npmIdx, true, nil
+}
+
+func appendUvarintString(buf []byte, s string) []byte {
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(s)))
+	buf = append(buf, lenBuf[:n]...)
+	return append(buf, s...)
+}
+
+func readUvarintString(blob []byte, offset int) (string, int, error) {
+	length, n := binary.Uvarint(blob[offset:])
+	if n <= 0 {
+		return "", 0, errInvalidV2Header("modules index: specifier uvarint")
+	}
+	start := offset + n
+	end := start + int(length)
+	if end > len(blob) {
+		return "", 0, errInvalidV2Header("modules index: specifier bytes")
+	}
+	return string(blob[start:end]), end, nil
+}
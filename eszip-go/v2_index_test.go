@@ -0,0 +1,111 @@
+// Copyright 2018-2024 the Deno authors. All rights reserved. MIT license.
+
+package eszip
+
+import "testing"
+
+func TestParseModulesHeaderV3IsLazy(t *testing.T) {
+	entries := []indexHeaderEntry{
+		{specifier: "file:///a.ts", encoded: encodeTestModuleEntry(t, &ModuleData{Kind: ModuleKindJavaScript})},
+		{specifier: "file:///b.ts", encoded: encodeTestModuleEntry(t, &ModuleData{Kind: ModuleKindJavaScript})},
+		{specifier: "file:///c.ts", encoded: encodeTestModuleEntry(t, &ModuleData{Kind: ModuleKindJavaScript})},
+	}
+	header := encodeIndexedModulesHeader(entries)
+
+	modules, npmSpecifiers, err := parseModulesHeaderV3(header, false, false)
+	if err != nil {
+		t.Fatalf("parseModulesHeaderV3 failed: %v", err)
+	}
+	if len(npmSpecifiers) != 0 {
+		t.Fatalf("expected no npm specifiers, got %v", npmSpecifiers)
+	}
+	if modules.Len() != 3 {
+		t.Fatalf("expected 3 specifiers, got %d", modules.Len())
+	}
+
+	// Nothing should have been decoded yet: parseModulesHeaderV3 only walked
+	// the index's specifiers and entry kinds, not their full entries.
+	modules.mu.RLock()
+	decodedBeforeGet := len(modules.data)
+	modules.mu.RUnlock()
+	if decodedBeforeGet != 0 {
+		t.Fatalf("expected 0 entries decoded before any Get, got %d", decodedBeforeGet)
+	}
+
+	mod, ok := modules.Get("file:///b.ts")
+	if !ok {
+		t.Fatal("expected file:///b.ts to be found")
+	}
+	if _, ok := mod.(*ModuleData); !ok {
+		t.Fatalf("expected *ModuleData, got %T", mod)
+	}
+
+	// Only the looked-up entry should now be decoded -- the other two
+	// specifiers are still untouched.
+	modules.mu.RLock()
+	decodedAfterGet := len(modules.data)
+	modules.mu.RUnlock()
+	if decodedAfterGet != 1 {
+		t.Fatalf("expected exactly 1 entry decoded after a single Get, got %d", decodedAfterGet)
+	}
+
+	if _, ok := modules.Get("file:///does-not-exist.ts"); ok {
+		t.Fatal("expected a lookup miss for an unknown specifier")
+	}
+
+	if got := modules.Keys(); len(got) != 3 || got[0] != "file:///a.ts" || got[2] != "file:///c.ts" {
+		t.Fatalf("expected specifier-sorted keys, got %v", got)
+	}
+}
+
+func TestParseModulesHeaderV3SeparatesNpmSpecifiers(t *testing.T) {
+	entries := []indexHeaderEntry{
+		{specifier: "file:///a.ts", encoded: encodeTestModuleEntry(t, &ModuleData{Kind: ModuleKindJavaScript})},
+		{specifier: "npm:left-pad@1.0.0", encoded: encodeTestNpmEntry(7)},
+	}
+	header := encodeIndexedModulesHeader(entries)
+
+	modules, npmSpecifiers, err := parseModulesHeaderV3(header, true, false)
+	if err != nil {
+		t.Fatalf("parseModulesHeaderV3 failed: %v", err)
+	}
+
+	idx, ok := npmSpecifiers["npm:left-pad@1.0.0"]
+	if !ok || idx.Index != 7 {
+		t.Fatalf("expected npm:left-pad@1.0.0 -> index 7, got %+v, ok=%v", idx, ok)
+	}
+	if modules.Len() != 1 {
+		t.Fatalf("expected npm specifier to be excluded from the module map, got %d entries", modules.Len())
+	}
+	if _, ok := modules.Get("npm:left-pad@1.0.0"); ok {
+		t.Fatal("npm specifier should not be reachable via ModuleMap.Get")
+	}
+}
+
+// encodeTestModuleEntry hand-builds a module entry in the layout
+// decodeModuleEntry reads when supportsCompression is false: the entry
+// kind, four zero u32 offsets/lengths (so both slots decode as empty), then
+// the module kind byte.
+func encodeTestModuleEntry(t *testing.T, mod EszipV2Module) []byte {
+	t.Helper()
+	switch m := mod.(type) {
+	case *ModuleData:
+		entry := []byte{entryKindModule}
+		entry = appendU32BE(entry, 0)
+		entry = appendU32BE(entry, 0)
+		entry = appendU32BE(entry, 0)
+		entry = appendU32BE(entry, 0)
+		entry = append(entry, byte(m.Kind))
+		return entry
+	default:
+		t.Fatalf("unsupported test module type %T", mod)
+		return nil
+	}
+}
+
+// encodeTestNpmEntry mirrors encodeTestModuleEntry for the npm-specifier
+// entry kind, which isn't an EszipV2Module (see decodeModuleEntry).
+func encodeTestNpmEntry(packageID uint32) []byte {
+	entry := []byte{entryKindNpmSpecifier}
+	return appendU32BE(entry, packageID)
+}
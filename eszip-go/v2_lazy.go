@@ -0,0 +1,224 @@
+// Copyright 2018-2024 the Deno authors. All rights reserved. MIT license.
+
+package eszip
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+)
+
+// ParseV2Lazy parses only the options header, modules header, and npm
+// section of a V2 eszip up front, and defers reading the sources and
+// source maps until a caller actually asks for them.
+//
+// Unlike ParseV2, which must buffer the whole stream, ParseV2Lazy only
+// needs random access (via io.ReaderAt) and the total archive size. Each
+// ModuleData's Source and SourceMap slots are populated with a
+// *io.SectionReader pointing at their absolute offset within ra, and are
+// decoded (and checksum-verified) on first Module.Source/SourceMap call.
+func ParseV2Lazy(ctx context.Context, ra io.ReaderAt, size int64) (*EszipV2, error) {
+	r := io.NewSectionReader(ra, 0, size)
+	var pos int64
+
+	readFull := func(buf []byte) error {
+		n, err := io.ReadFull(r, buf)
+		pos += int64(n)
+		if err != nil {
+			return errIO(err)
+		}
+		return nil
+	}
+
+	// Magic bytes.
+	magic := make([]byte, 8)
+	if err := readFull(magic); err != nil {
+		return nil, err
+	}
+
+	version, ok := VersionFromMagic(magic)
+	if !ok {
+		return nil, errInvalidV2()
+	}
+
+	options := DefaultOptionsForVersion(version)
+	if version.SupportsOptions() {
+		var err error
+		options, err = parseOptionsHeaderAt(readFull, options)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if options.Chunking {
+		return nil, errInvalidV2Header("ParseV2Lazy does not support chunked (deduplicated) archives; use ParseV2Sync instead")
+	}
+
+	modulesHeader, err := readSectionAt(readFull, options)
+	if err != nil {
+		return nil, err
+	}
+	if !modulesHeader.IsChecksumValid() {
+		return nil, errInvalidV2HeaderHash()
+	}
+
+	var modules *ModuleMap
+	var npmSpecifiers map[string]NpmPackageIndex
+	if version.SupportsSortedIndex() {
+		modules, npmSpecifiers, err = parseModulesHeaderV3(modulesHeader.Content(), version.SupportsNpm(), version.SupportsCompression())
+	} else {
+		modules, npmSpecifiers, err = parseModulesHeader(modulesHeader.Content(), version.SupportsNpm(), version.SupportsCompression())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var npmSnapshot *NpmResolutionSnapshot
+	if version.SupportsNpm() {
+		npmSection, err := readSectionAt(readFull, options)
+		if err != nil {
+			return nil, err
+		}
+		if !npmSection.IsChecksumValid() {
+			return nil, errInvalidV2NpmSnapshotHash()
+		}
+		npmSnapshot, err = parseNpmSectionContent(npmSection.Content(), npmSpecifiers, options.NpmDepKinds)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The sources section starts right after the npm section.
+	if err := attachLazySources(ra, &pos, readFull, options, modules, true); err != nil {
+		return nil, err
+	}
+	if err := attachLazySources(ra, &pos, readFull, options, modules, false); err != nil {
+		return nil, err
+	}
+
+	return &EszipV2{
+		modules:     modules,
+		npmSnapshot: npmSnapshot,
+		options:     options,
+		version:     version,
+	}, nil
+}
+
+// attachLazySources reads a sources-section (or source-maps-section) length
+// prefix and arranges for every pending slot in that section to be rewired
+// as a lazy, ReaderAt-backed slot the moment its module is actually decoded,
+// via modules.OnDecode -- so a V3 archive parsed through ParseV2Lazy (see
+// parseModulesHeaderV3) doesn't have to decode every module just to attach
+// its source slots. Neither the content nor the checksum hash is read here;
+// both are deferred to the slot's first Get/Take (see NewLazySourceSlot).
+func attachLazySources(ra io.ReaderAt, pos *int64, readFull func([]byte) error, options Options, modules *ModuleMap, isSource bool) error {
+	lenBytes := make([]byte, 4)
+	if err := readFull(lenBytes); err != nil {
+		return err
+	}
+	sectionLen := binary.BigEndian.Uint32(lenBytes)
+	sectionStart := *pos
+
+	checksumSize := int64(options.GetChecksumSize())
+
+	modules.OnDecode(func(_ string, data *ModuleData) {
+		slot := data.Source
+		if !isSource {
+			slot = data.SourceMap
+		}
+		if slot.State() != SourceSlotPending || slot.Length() == 0 {
+			return
+		}
+
+		absOffset := sectionStart + int64(slot.Offset())
+		content := io.NewSectionReader(ra, absOffset, int64(slot.Length()))
+		hash := io.NewSectionReader(ra, absOffset+int64(slot.Length()), checksumSize)
+
+		lazy := NewLazySourceSlot(content, options.Checksum, options.Compression, hash, slot.Offset(), slot.Length())
+		if isSource {
+			data.Source = lazy
+		} else {
+			data.SourceMap = lazy
+		}
+	})
+
+	*pos = sectionStart + int64(sectionLen)
+	return nil
+}
+
+func parseOptionsHeaderAt(readFull func([]byte) error, defaults Options) (Options, error) {
+	lenBytes := make([]byte, 4)
+	if err := readFull(lenBytes); err != nil {
+		return defaults, err
+	}
+	length := binary.BigEndian.Uint32(lenBytes)
+
+	content := make([]byte, length)
+	if err := readFull(content); err != nil {
+		return defaults, err
+	}
+
+	if len(content)%2 != 0 {
+		return defaults, errInvalidV22OptionsHeader("options are expected to be byte tuples")
+	}
+
+	options := defaults
+	for i := 0; i < len(content); i += 2 {
+		switch content[i] {
+		case 0:
+			if checksum, ok := ChecksumFromU8(content[i+1]); ok {
+				options.Checksum = checksum
+			}
+		case 1:
+			options.ChecksumSize = content[i+1]
+		case 2:
+			if compression, ok := CompressionFromU8(content[i+1]); ok {
+				options.Compression = compression
+			}
+		case 3:
+			options.Chunking = content[i+1] != 0
+		case 4:
+			options.NpmDepKinds = content[i+1] != 0
+		}
+	}
+
+	if options.GetChecksumSize() == 0 && options.Checksum != ChecksumNone {
+		return defaults, errInvalidV22OptionsHeader("checksum size must be known")
+	}
+
+	if options.GetChecksumSize() > 0 {
+		hash := make([]byte, options.GetChecksumSize())
+		if err := readFull(hash); err != nil {
+			return defaults, err
+		}
+		if !options.Checksum.Verify(content, hash) {
+			return defaults, errInvalidV22OptionsHeaderHash()
+		}
+	}
+
+	return options, nil
+}
+
+func readSectionAt(readFull func([]byte) error, options Options) (*Section, error) {
+	lenBytes := make([]byte, 4)
+	if err := readFull(lenBytes); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(lenBytes)
+
+	content := make([]byte, length)
+	if err := readFull(content); err != nil {
+		return nil, err
+	}
+
+	checksumSize := options.GetChecksumSize()
+	var hash []byte
+	if checksumSize > 0 {
+		hash = make([]byte, checksumSize)
+		if err := readFull(hash); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Section{content: content, hash: hash, checksum: options.Checksum}, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2018-2024 the Deno authors. All rights reserved. MIT license.
+
+package eszip
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+)
+
+// TestParseV2LazyDefersSourceAttach pins down the laziness ParseV2Lazy is
+// for: attachLazySources must not force every module to decode just to wire
+// up its source slot. Only the looked-up module (and its one dependency on
+// the two attachLazySources passes) should end up in modules.data.
+func TestParseV2LazyDefersSourceAttach(t *testing.T) {
+	ctx := context.Background()
+	const moduleCount = 20
+
+	eszip := NewV2()
+	for i := 0; i < moduleCount; i++ {
+		eszip.AddModule(fmt.Sprintf("file:///mod%d.ts", i), ModuleKindJavaScript, []byte(fmt.Sprintf("content %d", i)), []byte(fmt.Sprintf(`{"version":3,"file":"mod%d"}`, i)))
+	}
+
+	data, err := eszip.IntoBytes()
+	if err != nil {
+		t.Fatalf("failed to serialize archive: %v", err)
+	}
+
+	lazy, err := ParseV2Lazy(ctx, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseV2Lazy failed: %v", err)
+	}
+
+	lazy.modules.mu.RLock()
+	decodedAfterParse := len(lazy.modules.data)
+	lazy.modules.mu.RUnlock()
+	if decodedAfterParse != 0 {
+		t.Fatalf("expected 0 modules decoded right after ParseV2Lazy, got %d out of %d", decodedAfterParse, moduleCount)
+	}
+
+	module := lazy.GetModule("file:///mod5.ts")
+	if module == nil {
+		t.Fatal("expected to find module")
+	}
+	source, err := module.Source(ctx)
+	if err != nil {
+		t.Fatalf("failed to get source: %v", err)
+	}
+	if string(source) != "content 5" {
+		t.Fatalf("unexpected source: %q", source)
+	}
+	sourceMap, err := module.SourceMap(ctx)
+	if err != nil {
+		t.Fatalf("failed to get source map: %v", err)
+	}
+	if string(sourceMap) != `{"version":3,"file":"mod5"}` {
+		t.Fatalf("unexpected source map: %q", sourceMap)
+	}
+
+	lazy.modules.mu.RLock()
+	decodedAfterGet := len(lazy.modules.data)
+	lazy.modules.mu.RUnlock()
+	if decodedAfterGet != 1 {
+		t.Fatalf("expected only the looked-up module to be decoded, got %d out of %d", decodedAfterGet, moduleCount)
+	}
+}
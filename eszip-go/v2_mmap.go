@@ -0,0 +1,247 @@
+// Copyright 2018-2024 the Deno authors. All rights reserved. MIT license.
+
+//go:build unix
+
+package eszip
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// ParseOptions configures ParseFile. It is currently empty and reserved for
+// future knobs (e.g. eager checksum verification); pass the zero value.
+type ParseOptions struct{}
+
+// MappedEszip is a V2 eszip backed by a memory-mapped file (see ParseFile).
+// Every module's source and source map are served as sub-slices of the
+// mapping rather than copied into RAM up front, which keeps peak memory
+// roughly constant regardless of archive size.
+//
+// Close must be called once the archive is no longer needed. Reading a
+// module's Source/SourceMap after Close is safe only for data obtained via
+// TakeSource/TakeSourceMap, or via Source/SourceMap on an archive that uses
+// a compression algorithm other than CompressionNone (whose Decompress
+// always allocates a fresh copy). For an uncompressed archive, Source and
+// SourceMap hand back a slice of the mapping itself -- that's the whole
+// point of mapping the file instead of reading it -- so that data is
+// invalidated by Close exactly like an unresolved slot's would be. Take the
+// source before closing if it needs to outlive the mapping.
+type MappedEszip struct {
+	*EszipV2
+
+	mapped *mappedFile
+}
+
+// Close unmaps the underlying file. It is safe to call more than once.
+func (m *MappedEszip) Close() error {
+	if m.mapped == nil {
+		return nil
+	}
+	err := m.mapped.Close()
+	m.mapped = nil
+	return err
+}
+
+// mappedFile owns the memory mapping of an eszip archive on disk.
+type mappedFile struct {
+	file *os.File
+	data []byte
+}
+
+func mapFile(path string) (*mappedFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errIO(err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, errIO(err)
+	}
+	if info.Size() == 0 {
+		f.Close()
+		return nil, errInvalidV2()
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("eszip: mmap %s: %w", path, err)
+	}
+
+	return &mappedFile{file: f, data: data}, nil
+}
+
+func (m *mappedFile) Close() error {
+	err := syscall.Munmap(m.data)
+	if cerr := m.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ParseFile parses a V2 eszip archive by memory-mapping path. Unlike
+// ParseBytes/ParseSync, which read the whole archive into RAM, the returned
+// MappedEszip's module sources and source maps are sub-slices of the
+// mapping, verified and (if the archive is compressed) decompressed lazily
+// on first access -- see SourceSlotMapped.
+func ParseFile(ctx context.Context, path string, opts ParseOptions) (*MappedEszip, error) {
+	_ = opts
+
+	mapped, err := mapFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	eszip, err := parseV2Mapped(mapped.data)
+	if err != nil {
+		mapped.Close()
+		return nil, err
+	}
+
+	return &MappedEszip{EszipV2: eszip, mapped: mapped}, nil
+}
+
+// parseV2Mapped parses the header, modules, and (if present) npm section of
+// a V2 archive directly out of data, the same way ParseV2Lazy does over an
+// io.ReaderAt, then attaches every source/source-map slot as a
+// SourceSlotMapped sub-slice of data rather than a lazy io.ReaderAt reader.
+func parseV2Mapped(data []byte) (*EszipV2, error) {
+	var pos int64
+
+	readFull := func(buf []byte) error {
+		if pos+int64(len(buf)) > int64(len(data)) {
+			return errIO(fmt.Errorf("unexpected end of file"))
+		}
+		copy(buf, data[pos:pos+int64(len(buf))])
+		pos += int64(len(buf))
+		return nil
+	}
+
+	magic := make([]byte, 8)
+	if err := readFull(magic); err != nil {
+		return nil, err
+	}
+
+	version, ok := VersionFromMagic(magic)
+	if !ok {
+		return nil, errInvalidV2()
+	}
+
+	options := DefaultOptionsForVersion(version)
+	if version.SupportsOptions() {
+		var err error
+		options, err = parseOptionsHeaderAt(readFull, options)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if options.Chunking {
+		return nil, errInvalidV2Header("ParseFile does not support chunked (deduplicated) archives yet")
+	}
+
+	modulesHeader, err := readSectionAt(readFull, options)
+	if err != nil {
+		return nil, err
+	}
+	if !modulesHeader.IsChecksumValid() {
+		return nil, errInvalidV2HeaderHash()
+	}
+
+	var modules *ModuleMap
+	var npmSpecifiers map[string]NpmPackageIndex
+	if version.SupportsSortedIndex() {
+		modules, npmSpecifiers, err = parseModulesHeaderV3(modulesHeader.Content(), version.SupportsNpm(), version.SupportsCompression())
+	} else {
+		modules, npmSpecifiers, err = parseModulesHeader(modulesHeader.Content(), version.SupportsNpm(), version.SupportsCompression())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var npmSnapshot *NpmResolutionSnapshot
+	if version.SupportsNpm() {
+		npmSection, err := readSectionAt(readFull, options)
+		if err != nil {
+			return nil, err
+		}
+		if !npmSection.IsChecksumValid() {
+			return nil, errInvalidV2NpmSnapshotHash()
+		}
+		npmSnapshot, err = parseNpmSectionContent(npmSection.Content(), npmSpecifiers, options.NpmDepKinds)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := attachMappedSources(data, &pos, options, modules, true); err != nil {
+		return nil, err
+	}
+	if err := attachMappedSources(data, &pos, options, modules, false); err != nil {
+		return nil, err
+	}
+
+	return &EszipV2{
+		modules:     modules,
+		npmSnapshot: npmSnapshot,
+		options:     options,
+		version:     version,
+	}, nil
+}
+
+// attachMappedSources reads a sources-section (or source-maps-section)
+// length prefix and arranges for every pending slot in that section to be
+// rewired as a SourceSlotMapped slot pointing directly into data, with no
+// intervening copy or io.Reader, the moment its module is actually decoded
+// -- via modules.OnDecode, the same deferred-attach mechanism
+// attachLazySources uses, so a lazily-parsed V3 archive doesn't have to
+// decode every module just to attach its source slots.
+//
+// An out-of-range offset can only be detected once its module is decoded,
+// which may be after this function has returned; in that case the slot is
+// set to SourceSlotInvalid instead of this function returning an error.
+func attachMappedSources(data []byte, pos *int64, options Options, modules *ModuleMap, isSource bool) error {
+	if *pos+4 > int64(len(data)) {
+		return errIO(fmt.Errorf("unexpected end of file"))
+	}
+	sectionLen := binary.BigEndian.Uint32(data[*pos : *pos+4])
+	*pos += 4
+	sectionStart := *pos
+
+	checksumSize := int64(options.GetChecksumSize())
+
+	modules.OnDecode(func(_ string, entry *ModuleData) {
+		slot := entry.Source
+		if !isSource {
+			slot = entry.SourceMap
+		}
+		if slot.State() != SourceSlotPending || slot.Length() == 0 {
+			return
+		}
+
+		contentStart := sectionStart + int64(slot.Offset())
+		contentEnd := contentStart + int64(slot.Length())
+		hashEnd := contentEnd + checksumSize
+
+		var mapped *SourceSlot
+		if contentStart < 0 || hashEnd > int64(len(data)) {
+			mapped = NewInvalidSourceSlot(errInvalidV2SourceOffset(int(slot.Offset())))
+		} else {
+			mapped = NewMappedSourceSlot(data[contentStart:contentEnd:contentEnd], data[contentEnd:hashEnd:hashEnd], options.Checksum, options.Compression, slot.Offset(), slot.Length())
+		}
+		if isSource {
+			entry.Source = mapped
+		} else {
+			entry.SourceMap = mapped
+		}
+	})
+
+	*pos = sectionStart + int64(sectionLen)
+	return nil
+}
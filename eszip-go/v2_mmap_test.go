@@ -0,0 +1,202 @@
+// Copyright 2018-2024 the Deno authors. All rights reserved. MIT license.
+
+//go:build unix
+
+package eszip
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"testing"
+)
+
+func writeSyntheticArchive(t testing.TB, moduleCount, moduleSize int) string {
+	t.Helper()
+
+	eszip := NewV2()
+	source := make([]byte, moduleSize)
+	for i := range source {
+		source[i] = byte(i)
+	}
+	for i := 0; i < moduleCount; i++ {
+		eszip.AddModule(fmt.Sprintf("file:///mod%d.wasm", i), ModuleKindOpaqueData, source, nil)
+	}
+
+	data, err := eszip.IntoBytes()
+	if err != nil {
+		t.Fatalf("failed to serialize synthetic archive: %v", err)
+	}
+
+	f, err := os.CreateTemp(t.TempDir(), "synthetic-*.eszip2")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		t.Fatalf("failed to write temp file: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("failed to close temp file: %v", err)
+	}
+
+	return f.Name()
+}
+
+func TestParseFileRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	path := writeSyntheticArchive(t, 3, 1024)
+
+	eszip, err := ParseFile(ctx, path, ParseOptions{})
+	if err != nil {
+		t.Fatalf("failed to parse file: %v", err)
+	}
+	defer eszip.Close()
+
+	module := eszip.GetModule("file:///mod1.wasm")
+	if module == nil {
+		t.Fatal("expected to find module")
+	}
+	if module.inner == nil {
+		t.Fatal("expected module inner to be set")
+	}
+
+	source, err := module.Source(ctx)
+	if err != nil {
+		t.Fatalf("failed to get source: %v", err)
+	}
+	if len(source) != 1024 {
+		t.Fatalf("expected 1024 bytes, got %d", len(source))
+	}
+	for i, b := range source {
+		if b != byte(i) {
+			t.Fatalf("source mismatch at %d: got %d", i, b)
+		}
+	}
+
+	taken, err := module.TakeSource(ctx)
+	if err != nil {
+		t.Fatalf("failed to take source: %v", err)
+	}
+	if len(taken) != 1024 {
+		t.Fatalf("expected 1024 bytes from TakeSource, got %d", len(taken))
+	}
+}
+
+// TestParseFileGetIsZeroCopyForUncompressed pins down the contract
+// documented on MappedEszip.Close and SourceSlotMapped: for an uncompressed
+// archive, Get hands back the mapped bytes directly rather than a copy, so
+// repeated calls return the same backing array.
+func TestParseFileGetIsZeroCopyForUncompressed(t *testing.T) {
+	ctx := context.Background()
+	path := writeSyntheticArchive(t, 1, 4096)
+
+	eszip, err := ParseFile(ctx, path, ParseOptions{})
+	if err != nil {
+		t.Fatalf("failed to parse file: %v", err)
+	}
+	defer eszip.Close()
+
+	module := eszip.GetModule("file:///mod0.wasm")
+	if module == nil {
+		t.Fatal("expected to find module")
+	}
+
+	first, err := module.Source(ctx)
+	if err != nil {
+		t.Fatalf("failed to get source: %v", err)
+	}
+	second, err := module.Source(ctx)
+	if err != nil {
+		t.Fatalf("failed to get source: %v", err)
+	}
+	if len(first) == 0 || &first[0] != &second[0] {
+		t.Error("expected repeated Get calls on an uncompressed mapped slot to share the same backing array")
+	}
+}
+
+// TestParseFileDefersSourceAttach mirrors TestParseV2LazyDefersSourceAttach
+// for the mmap-backed path: attachMappedSources must not force every module
+// to decode just to wire up its source slot.
+func TestParseFileDefersSourceAttach(t *testing.T) {
+	ctx := context.Background()
+	const moduleCount = 20
+	path := writeSyntheticArchive(t, moduleCount, 64)
+
+	eszip, err := ParseFile(ctx, path, ParseOptions{})
+	if err != nil {
+		t.Fatalf("failed to parse file: %v", err)
+	}
+	defer eszip.Close()
+
+	eszip.modules.mu.RLock()
+	decodedAfterParse := len(eszip.modules.data)
+	eszip.modules.mu.RUnlock()
+	if decodedAfterParse != 0 {
+		t.Fatalf("expected 0 modules decoded right after ParseFile, got %d out of %d", decodedAfterParse, moduleCount)
+	}
+
+	module := eszip.GetModule("file:///mod5.wasm")
+	if module == nil {
+		t.Fatal("expected to find module")
+	}
+	if _, err := module.Source(ctx); err != nil {
+		t.Fatalf("failed to get source: %v", err)
+	}
+
+	eszip.modules.mu.RLock()
+	decodedAfterGet := len(eszip.modules.data)
+	eszip.modules.mu.RUnlock()
+	if decodedAfterGet != 1 {
+		t.Fatalf("expected only the looked-up module to be decoded, got %d out of %d", decodedAfterGet, moduleCount)
+	}
+}
+
+// BenchmarkParseBytesVsParseFile compares peak heap growth when loading a
+// synthetic 500MB archive with ParseBytes (which buffers every source in
+// RAM up front) versus ParseFile (which only maps the file and resolves
+// sources lazily). Run with: go test -bench ParseBytesVsParseFile -run ^$
+func BenchmarkParseBytesVsParseFile(b *testing.B) {
+	const moduleSize = 50 << 20 // 50MB per module
+	const moduleCount = 10      // ~500MB archive
+
+	path := writeSyntheticArchive(b, moduleCount, moduleSize)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		b.Fatalf("failed to read synthetic archive: %v", err)
+	}
+
+	b.Run("ParseBytes", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+
+			eszip, err := ParseBytes(context.Background(), data)
+			if err != nil {
+				b.Fatalf("ParseBytes failed: %v", err)
+			}
+
+			runtime.ReadMemStats(&after)
+			b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/(1<<20), "MB/op-heap")
+			_ = eszip
+		}
+	})
+
+	b.Run("ParseFile", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+
+			eszip, err := ParseFile(context.Background(), path, ParseOptions{})
+			if err != nil {
+				b.Fatalf("ParseFile failed: %v", err)
+			}
+
+			runtime.ReadMemStats(&after)
+			b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/(1<<20), "MB/op-heap")
+			eszip.Close()
+		}
+	})
+}
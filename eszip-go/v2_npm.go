@@ -19,6 +19,45 @@ type NpmResolutionSnapshot struct {
 type NpmPackage struct {
 	ID           *NpmPackageID
 	Dependencies map[string]*NpmPackageID // req -> id
+
+	// PeerDependencies, OptionalDependencies and OptionalPeerDependencies
+	// hold this package's peer, optional and optional-peer dependencies
+	// respectively, keyed the same way as Dependencies. They round-trip
+	// through the npm section only when the archive has Options.NpmDepKinds
+	// set (see NpmDependencyKind); older archives have no way to express
+	// these and resolve every dependency into Dependencies.
+	PeerDependencies         map[string]*NpmPackageID // req -> id
+	OptionalDependencies     map[string]*NpmPackageID // req -> id
+	OptionalPeerDependencies map[string]*NpmPackageID // req -> id
+}
+
+// NpmDependencyKind distinguishes an npm package's ordinary dependencies
+// from its peer and optional ones. It's encoded as a single byte per
+// dependency entry, but only when Options.NpmDepKinds is set -- see
+// parseNpmModule.
+type NpmDependencyKind uint8
+
+const (
+	NpmDependencyRegular NpmDependencyKind = iota
+	NpmDependencyPeer
+	NpmDependencyOptional
+	NpmDependencyPeerOptional
+)
+
+// npmSnapshotHasDepKinds reports whether any package in snapshot has a
+// peer, optional, or optional-peer dependency, meaning the npm section
+// needs to be written with per-dependency kind tags (Options.NpmDepKinds)
+// for them to survive a round trip.
+func npmSnapshotHasDepKinds(snapshot *NpmResolutionSnapshot) bool {
+	if snapshot == nil {
+		return false
+	}
+	for _, pkg := range snapshot.Packages {
+		if len(pkg.PeerDependencies) > 0 || len(pkg.OptionalDependencies) > 0 || len(pkg.OptionalPeerDependencies) > 0 {
+			return true
+		}
+	}
+	return false
 }
 
 // NpmPackageID represents an NPM package identifier (name@version)
@@ -58,7 +97,13 @@ func parseNpmSection(br *bufio.Reader, options Options, npmSpecifiers map[string
 		return nil, errInvalidV2NpmSnapshotHash()
 	}
 
-	content := section.Content()
+	return parseNpmSectionContent(section.Content(), npmSpecifiers, options.NpmDepKinds)
+}
+
+// parseNpmSectionContent decodes an already-read, checksum-verified npm
+// section body. Split out from parseNpmSection so the lazy, ReaderAt-backed
+// parser in v2_lazy.go can reuse the same decoding logic.
+func parseNpmSectionContent(content []byte, npmSpecifiers map[string]NpmPackageIndex, depKinds bool) (*NpmResolutionSnapshot, error) {
 	if len(content) == 0 {
 		return nil, nil
 	}
@@ -68,7 +113,7 @@ func parseNpmSection(br *bufio.Reader, options Options, npmSpecifiers map[string
 	offset := 0
 
 	for offset < len(content) {
-		entry, newOffset, err := parseNpmModule(content, offset)
+		entry, newOffset, err := parseNpmModule(content, offset, depKinds)
 		if err != nil {
 			return nil, errInvalidV2NpmPackageOffset(offset, err)
 		}
@@ -91,18 +136,33 @@ func parseNpmSection(br *bufio.Reader, options Options, npmSpecifiers map[string
 	for i, pkg := range packages {
 		id := pkgIndexToID[uint32(i)]
 		deps := make(map[string]*NpmPackageID)
+		peerDeps := make(map[string]*NpmPackageID)
+		optDeps := make(map[string]*NpmPackageID)
+		optPeerDeps := make(map[string]*NpmPackageID)
 
-		for req, idx := range pkg.dependencies {
-			depID, ok := pkgIndexToID[idx]
+		for req, ref := range pkg.dependencies {
+			depID, ok := pkgIndexToID[ref.index]
 			if !ok {
-				return nil, errInvalidV2NpmPackage(pkg.name, fmt.Errorf("missing index '%d'", idx))
+				return nil, errInvalidV2NpmPackage(pkg.name, fmt.Errorf("missing index '%d'", ref.index))
+			}
+			switch ref.kind {
+			case NpmDependencyPeer:
+				peerDeps[req] = depID
+			case NpmDependencyOptional:
+				optDeps[req] = depID
+			case NpmDependencyPeerOptional:
+				optPeerDeps[req] = depID
+			default:
+				deps[req] = depID
 			}
-			deps[req] = depID
 		}
 
 		finalPackages = append(finalPackages, &NpmPackage{
-			ID:           id,
-			Dependencies: deps,
+			ID:                       id,
+			Dependencies:             deps,
+			PeerDependencies:         peerDeps,
+			OptionalDependencies:     optDeps,
+			OptionalPeerDependencies: optPeerDeps,
 		})
 	}
 
@@ -122,13 +182,25 @@ func parseNpmSection(br *bufio.Reader, options Options, npmSpecifiers map[string
 	}, nil
 }
 
+// npmDependencyRef is the intermediate, index-based form of a dependency
+// edge before pkgIndexToID resolves it to an *NpmPackageID.
+type npmDependencyRef struct {
+	index uint32
+	kind  NpmDependencyKind
+}
+
 // npmModuleEntry is an intermediate structure for parsing
 type npmModuleEntry struct {
 	name         string
-	dependencies map[string]uint32 // req -> package index
+	dependencies map[string]npmDependencyRef // req -> package index + kind
 }
 
-func parseNpmModule(content []byte, offset int) (*npmModuleEntry, int, error) {
+// parseNpmModule parses a single package entry from the npm section. When
+// depKinds is true (Options.NpmDepKinds), each dependency carries a
+// one-byte NpmDependencyKind tag before its package index; older archives
+// never set this option, so every dependency they encode is implicitly
+// NpmDependencyRegular.
+func parseNpmModule(content []byte, offset int, depKinds bool) (*npmModuleEntry, int, error) {
 	// Parse name
 	name, offset, err := parseNpmString(content, offset)
 	if err != nil {
@@ -143,7 +215,7 @@ func parseNpmModule(content []byte, offset int) (*npmModuleEntry, int, error) {
 	offset += 4
 
 	// Parse dependencies
-	deps := make(map[string]uint32)
+	deps := make(map[string]npmDependencyRef)
 	for i := uint32(0); i < depCount; i++ {
 		// Parse dependency name
 		depName, newOffset, err := parseNpmString(content, offset)
@@ -152,6 +224,15 @@ func parseNpmModule(content []byte, offset int) (*npmModuleEntry, int, error) {
 		}
 		offset = newOffset
 
+		kind := NpmDependencyRegular
+		if depKinds {
+			if offset+1 > len(content) {
+				return nil, 0, fmt.Errorf("unexpected end of data")
+			}
+			kind = NpmDependencyKind(content[offset])
+			offset++
+		}
+
 		// Parse package index
 		if offset+4 > len(content) {
 			return nil, 0, fmt.Errorf("unexpected end of data")
@@ -159,7 +240,7 @@ func parseNpmModule(content []byte, offset int) (*npmModuleEntry, int, error) {
 		pkgIndex := binary.BigEndian.Uint32(content[offset : offset+4])
 		offset += 4
 
-		deps[depName] = pkgIndex
+		deps[depName] = npmDependencyRef{index: pkgIndex, kind: kind}
 	}
 
 	return &npmModuleEntry{
@@ -5,6 +5,7 @@ package eszip
 import (
 	"bufio"
 	"context"
+	"crypto/sha256"
 	"encoding/binary"
 	"io"
 )
@@ -68,7 +69,13 @@ func parseV2WithVersion(ctx context.Context, version EszipVersion, br *bufio.Rea
 	}
 
 	// Parse module entries from header
-	modules, npmSpecifiers, err := parseModulesHeader(modulesHeader.Content(), supportsNpm)
+	var modules *ModuleMap
+	var npmSpecifiers map[string]NpmPackageIndex
+	if version.SupportsSortedIndex() {
+		modules, npmSpecifiers, err = parseModulesHeaderV3(modulesHeader.Content(), supportsNpm, version.SupportsCompression())
+	} else {
+		modules, npmSpecifiers, err = parseModulesHeader(modulesHeader.Content(), supportsNpm, version.SupportsCompression())
+	}
 	if err != nil {
 		return nil, nil, err
 	}
@@ -98,17 +105,19 @@ func parseV2WithVersion(ctx context.Context, version EszipVersion, br *bufio.Rea
 		}
 
 		if data.Source.State() == SourceSlotPending && data.Source.Length() > 0 {
-			sourceOffsets[int(data.Source.Offset())] = sourceOffsetEntry{
-				length:    int(data.Source.Length()),
-				specifier: specifier,
-			}
+			offset := int(data.Source.Offset())
+			entry := sourceOffsets[offset]
+			entry.length = int(data.Source.Length())
+			entry.specifiers = append(entry.specifiers, specifier)
+			sourceOffsets[offset] = entry
 		}
 
 		if data.SourceMap.State() == SourceSlotPending && data.SourceMap.Length() > 0 {
-			sourceMapOffsets[int(data.SourceMap.Offset())] = sourceOffsetEntry{
-				length:    int(data.SourceMap.Length()),
-				specifier: specifier,
-			}
+			offset := int(data.SourceMap.Offset())
+			entry := sourceMapOffsets[offset]
+			entry.length = int(data.SourceMap.Length())
+			entry.specifiers = append(entry.specifiers, specifier)
+			sourceMapOffsets[offset] = entry
 		}
 	}
 
@@ -157,6 +166,15 @@ func parseOptionsHeader(br *bufio.Reader, defaults Options) (Options, error) {
 			}
 		case 1: // Checksum size
 			options.ChecksumSize = value
+		case 2: // Compression algorithm
+			compression, ok := CompressionFromU8(value)
+			if ok {
+				options.Compression = compression
+			}
+		case 3: // Chunking enabled
+			options.Chunking = value != 0
+		case 4: // Npm dependency kind tags enabled
+			options.NpmDepKinds = value != 0
 		}
 		// Unknown options are ignored for forward compatibility
 	}
@@ -236,7 +254,7 @@ func readSectionWithSize(br *bufio.Reader, options Options, contentLen int) (*Se
 	}, nil
 }
 
-func parseModulesHeader(content []byte, supportsNpm bool) (*ModuleMap, map[string]NpmPackageIndex, error) {
+func parseModulesHeader(content []byte, supportsNpm, supportsCompression bool) (*ModuleMap, map[string]NpmPackageIndex, error) {
 	modules := NewModuleMap()
 	npmSpecifiers := make(map[string]NpmPackageIndex)
 
@@ -257,103 +275,163 @@ func parseModulesHeader(content []byte, supportsNpm bool) (*ModuleMap, map[strin
 		specifier := string(content[read : read+specifierLen])
 		read += specifierLen
 
-		// Read entry kind
-		if read+1 > len(content) {
-			return nil, nil, errInvalidV2Header("entry kind")
+		mod, npmIdx, newRead, err := decodeModuleEntry(content, read, specifier, supportsNpm, supportsCompression)
+		if err != nil {
+			return nil, nil, err
 		}
-		entryKind := content[read]
-		read++
+		read = newRead
 
-		switch entryKind {
-		case 0: // Module
-			if read+17 > len(content) {
-				return nil, nil, errInvalidV2Header("module data")
-			}
+		if npmIdx != nil {
+			npmSpecifiers[specifier] = *npmIdx
+		} else {
+			modules.Insert(specifier, mod)
+		}
+	}
 
-			sourceOffset := binary.BigEndian.Uint32(content[read : read+4])
-			read += 4
-			sourceLen := binary.BigEndian.Uint32(content[read : read+4])
-			read += 4
-			sourceMapOffset := binary.BigEndian.Uint32(content[read : read+4])
-			read += 4
-			sourceMapLen := binary.BigEndian.Uint32(content[read : read+4])
-			read += 4
-			kindByte := content[read]
-			read++
-
-			var kind ModuleKind
-			switch kindByte {
-			case 0:
-				kind = ModuleKindJavaScript
-			case 1:
-				kind = ModuleKindJson
-			case 2:
-				kind = ModuleKindJsonc
-			case 3:
-				kind = ModuleKindOpaqueData
-			case 4:
-				kind = ModuleKindWasm
-			default:
-				return nil, nil, errInvalidV2ModuleKind(kindByte, read)
-			}
+	return modules, npmSpecifiers, nil
+}
 
-			var source *SourceSlot
-			if sourceOffset == 0 && sourceLen == 0 {
-				source = NewEmptySourceSlot()
-			} else {
-				source = NewPendingSourceSlot(sourceOffset, sourceLen)
-			}
+// Entry kinds for a modules-header entry, shared by decodeModuleEntry below
+// and ModulesIndex.entryKindAt, which peeks this same byte without decoding
+// the rest of the entry.
+const (
+	entryKindModule       = 0
+	entryKindRedirect     = 1
+	entryKindNpmSpecifier = 2
+)
 
-			var sourceMap *SourceSlot
-			if sourceMapOffset == 0 && sourceMapLen == 0 {
-				sourceMap = NewEmptySourceSlot()
-			} else {
-				sourceMap = NewPendingSourceSlot(sourceMapOffset, sourceMapLen)
-			}
+// decodeModuleEntry decodes a single modules-header entry (module data,
+// redirect, or npm specifier) starting at content[offset], where offset
+// points just past the entry's specifier. It returns the decoded module
+// (nil for npm specifiers, which are reported via npmIdx instead) and the
+// offset of the next entry. Shared by the linear (v2) and sorted-index
+// (v3) modules header formats.
+func decodeModuleEntry(content []byte, offset int, specifier string, supportsNpm, supportsCompression bool) (EszipV2Module, *NpmPackageIndex, int, error) {
+	read := offset
+
+	// Read entry kind
+	if read+1 > len(content) {
+		return nil, nil, 0, errInvalidV2Header("entry kind")
+	}
+	entryKind := content[read]
+	read++
 
-			modules.Insert(specifier, &ModuleData{
-				Kind:      kind,
-				Source:    source,
-				SourceMap: sourceMap,
-			})
+	switch entryKind {
+	case entryKindModule: // Module
+		if read+17 > len(content) {
+			return nil, nil, 0, errInvalidV2Header("module data")
+		}
 
-		case 1: // Redirect
-			if read+4 > len(content) {
-				return nil, nil, errInvalidV2Header("target len")
-			}
-			targetLen := int(binary.BigEndian.Uint32(content[read : read+4]))
-			read += 4
+		sourceOffset := binary.BigEndian.Uint32(content[read : read+4])
+		read += 4
+		sourceLen := binary.BigEndian.Uint32(content[read : read+4])
+		read += 4
+		sourceMapOffset := binary.BigEndian.Uint32(content[read : read+4])
+		read += 4
+		sourceMapLen := binary.BigEndian.Uint32(content[read : read+4])
+		read += 4
+		kindByte := content[read]
+		read++
 
-			if read+targetLen > len(content) {
-				return nil, nil, errInvalidV2Header("target")
-			}
-			target := string(content[read : read+targetLen])
-			read += targetLen
+		var kind ModuleKind
+		switch kindByte {
+		case 0:
+			kind = ModuleKindJavaScript
+		case 1:
+			kind = ModuleKindJson
+		case 2:
+			kind = ModuleKindJsonc
+		case 3:
+			kind = ModuleKindOpaqueData
+		case 4:
+			kind = ModuleKindWasm
+		default:
+			return nil, nil, 0, errInvalidV2ModuleKind(kindByte, read)
+		}
 
-			modules.Insert(specifier, &ModuleRedirect{Target: target})
+		var source *SourceSlot
+		if sourceOffset == 0 && sourceLen == 0 {
+			source = NewEmptySourceSlot()
+		} else {
+			source = NewPendingSourceSlot(sourceOffset, sourceLen)
+		}
 
-		case 2: // NpmSpecifier
-			if !supportsNpm {
-				return nil, nil, errInvalidV2EntryKind(entryKind, read)
-			}
+		var sourceMap *SourceSlot
+		if sourceMapOffset == 0 && sourceMapLen == 0 {
+			sourceMap = NewEmptySourceSlot()
+		} else {
+			sourceMap = NewPendingSourceSlot(sourceMapOffset, sourceMapLen)
+		}
 
-			if read+4 > len(content) {
-				return nil, nil, errInvalidV2Header("npm package id")
+		var uncompressedSourceLen, uncompressedSourceMapLen uint32
+		if supportsCompression {
+			if read+8 > len(content) {
+				return nil, nil, 0, errInvalidV2Header("uncompressed lengths")
 			}
-			pkgID := binary.BigEndian.Uint32(content[read : read+4])
+			uncompressedSourceLen = binary.BigEndian.Uint32(content[read : read+4])
+			read += 4
+			uncompressedSourceMapLen = binary.BigEndian.Uint32(content[read : read+4])
 			read += 4
+		}
 
-			npmSpecifiers[specifier] = NpmPackageIndex{Index: pkgID}
+		return &ModuleData{
+			Kind:                     kind,
+			Source:                   source,
+			SourceMap:                sourceMap,
+			UncompressedSourceLen:    uncompressedSourceLen,
+			UncompressedSourceMapLen: uncompressedSourceMapLen,
+		}, nil, read, nil
 
-		default:
-			return nil, nil, errInvalidV2EntryKind(entryKind, read)
+	case entryKindRedirect: // Redirect
+		if read+4 > len(content) {
+			return nil, nil, 0, errInvalidV2Header("target len")
 		}
-	}
+		targetLen := int(binary.BigEndian.Uint32(content[read : read+4]))
+		read += 4
 
-	return modules, npmSpecifiers, nil
+		if read+targetLen > len(content) {
+			return nil, nil, 0, errInvalidV2Header("target")
+		}
+		target := string(content[read : read+targetLen])
+		read += targetLen
+
+		return &ModuleRedirect{Target: target}, nil, read, nil
+
+	case entryKindNpmSpecifier: // NpmSpecifier
+		if !supportsNpm {
+			return nil, nil, 0, errInvalidV2EntryKind(entryKind, read)
+		}
+
+		if read+4 > len(content) {
+			return nil, nil, 0, errInvalidV2Header("npm package id")
+		}
+		pkgID := binary.BigEndian.Uint32(content[read : read+4])
+		read += 4
+
+		return nil, &NpmPackageIndex{Index: pkgID}, read, nil
+
+	default:
+		return nil, nil, 0, errInvalidV2EntryKind(entryKind, read)
+	}
 }
 
 func loadSources(ctx context.Context, br *bufio.Reader, eszip *EszipV2, options Options, sourceOffsets, sourceMapOffsets map[int]sourceOffsetEntry) error {
+	// Read chunks section (only present when chunking is enabled)
+	var chunks *chunkStore
+	if options.Chunking {
+		section, err := readSection(br, options)
+		if err != nil {
+			return err
+		}
+		if !section.IsChecksumValid() {
+			return errInvalidV2Header("chunks section hash")
+		}
+		chunks, err = decodeChunksSection(section.Content(), options)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Read sources section
 	sourcesLenBytes := make([]byte, 4)
 	if _, err := io.ReadFull(br, sourcesLenBytes); err != nil {
@@ -374,23 +452,53 @@ func loadSources(ctx context.Context, br *bufio.Reader, eszip *EszipV2, options
 		}
 
 		if !section.IsChecksumValid() {
-			return errInvalidV2SourceHash(entry.specifier)
+			return errInvalidV2SourceHash(entry.specifiers[0])
 		}
 
 		read += section.TotalLen()
 
-		// Update the module's source slot
-		mod, ok := eszip.modules.Get(entry.specifier)
-		if !ok {
-			continue
+		content, err := options.Compression.Decompress(section.IntoContent())
+		if err != nil {
+			return err
 		}
 
-		data, ok := mod.(*ModuleData)
-		if !ok {
-			continue
+		// Every specifier sharing this offset (see BuildOptions.Dedupe)
+		// gets the same content.
+		sourceHash := sha256.Sum256(content)
+		for _, specifier := range entry.specifiers {
+			mod, ok := eszip.modules.Get(specifier)
+			if !ok {
+				continue
+			}
+
+			data, ok := mod.(*ModuleData)
+			if !ok {
+				continue
+			}
+
+			data.Source.SetReady(content)
+			data.SourceHash = sourceHash
 		}
+	}
 
-		data.Source.SetReady(section.IntoContent())
+	// Reassemble chunked sources from the chunks section
+	if options.Chunking {
+		for _, specifier := range eszip.modules.Keys() {
+			mod, ok := eszip.modules.Get(specifier)
+			if !ok {
+				continue
+			}
+			data, ok := mod.(*ModuleData)
+			if !ok || data.Source.State() != SourceSlotPending {
+				continue
+			}
+			content, err := chunks.assemble(data.Source.Offset(), data.Source.Length())
+			if err != nil {
+				return err
+			}
+			data.Source.SetReady(content)
+			data.SourceHash = sha256.Sum256(content)
+		}
 	}
 
 	// Read source maps section
@@ -413,23 +521,29 @@ func loadSources(ctx context.Context, br *bufio.Reader, eszip *EszipV2, options
 		}
 
 		if !section.IsChecksumValid() {
-			return errInvalidV2SourceHash(entry.specifier)
+			return errInvalidV2SourceHash(entry.specifiers[0])
 		}
 
 		read += section.TotalLen()
 
-		// Update the module's source map slot
-		mod, ok := eszip.modules.Get(entry.specifier)
-		if !ok {
-			continue
+		content, err := options.Compression.Decompress(section.IntoContent())
+		if err != nil {
+			return err
 		}
 
-		data, ok := mod.(*ModuleData)
-		if !ok {
-			continue
-		}
+		for _, specifier := range entry.specifiers {
+			mod, ok := eszip.modules.Get(specifier)
+			if !ok {
+				continue
+			}
 
-		data.SourceMap.SetReady(section.IntoContent())
+			data, ok := mod.(*ModuleData)
+			if !ok {
+				continue
+			}
+
+			data.SourceMap.SetReady(content)
+		}
 	}
 
 	return nil
@@ -11,6 +11,14 @@ import (
 func (e *EszipV2) IntoBytes() ([]byte, error) {
 	checksum := e.options.Checksum
 	checksumSize := e.options.GetChecksumSize()
+	compression := e.options.Compression
+	chunking := e.options.Chunking
+
+	dedupe := e.buildOptions.Dedupe
+	dedupeHash := e.buildOptions.DedupeHash
+	if dedupe && dedupeHash == ChecksumNone {
+		dedupeHash = ChecksumXxh3
+	}
 
 	var result []byte
 
@@ -18,10 +26,23 @@ func (e *EszipV2) IntoBytes() ([]byte, error) {
 	magic := LatestVersion.ToMagic()
 	result = append(result, magic[:]...)
 
+	npmDepKinds := npmSnapshotHasDepKinds(e.npmSnapshot)
+
 	// Build options header
+	chunkingByte := byte(0)
+	if chunking {
+		chunkingByte = 1
+	}
+	npmDepKindsByte := byte(0)
+	if npmDepKinds {
+		npmDepKindsByte = 1
+	}
 	optionsHeaderContent := []byte{
-		0, byte(checksum),     // Checksum type
+		0, byte(checksum), // Checksum type
 		1, byte(checksumSize), // Checksum size
+		2, byte(compression), // Compression algorithm
+		3, chunkingByte, // Chunking enabled
+		4, npmDepKindsByte, // Npm dependency kind tags enabled
 	}
 
 	// Write options header length
@@ -36,11 +57,25 @@ func (e *EszipV2) IntoBytes() ([]byte, error) {
 	optionsHash := checksum.Hash(optionsHeaderContent)
 	result = append(result, optionsHash...)
 
-	// Build modules header, sources, and source maps
-	var modulesHeader []byte
+	// Build the (specifier, encoded entry) list, plus sources/source maps.
+	// Encoding into the legacy linear layout vs. the sorted index layout
+	// (VersionV2_5+) happens afterwards, from the same entries.
+	var entries []indexHeaderEntry
 	var sources []byte
 	var sourceMaps []byte
 
+	var chunker *chunkBuilder
+	if chunking {
+		chunker = newChunkBuilder(checksum, compression)
+	}
+
+	var sourceDedup map[string][2]uint32
+	var sourceMapDedup map[string][2]uint32
+	if dedupe {
+		sourceDedup = make(map[string][2]uint32)
+		sourceMapDedup = make(map[string][2]uint32)
+	}
+
 	keys := e.modules.Keys()
 	for _, specifier := range keys {
 		mod, ok := e.modules.Get(specifier)
@@ -48,31 +83,41 @@ func (e *EszipV2) IntoBytes() ([]byte, error) {
 			continue
 		}
 
-		// Write specifier
-		appendString(&modulesHeader, specifier)
+		var encoded []byte
 
 		switch m := mod.(type) {
 		case *ModuleData:
 			// Write module entry
-			modulesHeader = append(modulesHeader, byte(HeaderFrameModule))
+			encoded = append(encoded, byte(HeaderFrameModule))
 
 			// Get source bytes
 			sourceBytes := m.Source.data
 			if sourceBytes == nil && m.Source.State() == SourceSlotReady {
 				sourceBytes = []byte{}
 			}
-			sourceLen := uint32(len(sourceBytes))
-
-			if sourceLen > 0 {
-				sourceOffset := uint32(len(sources))
-				sources = append(sources, sourceBytes...)
-				sources = append(sources, checksum.Hash(sourceBytes)...)
-
-				modulesHeader = appendU32BE(modulesHeader, sourceOffset)
-				modulesHeader = appendU32BE(modulesHeader, sourceLen)
+			uncompressedSourceLen := uint32(len(sourceBytes))
+
+			if chunker != nil {
+				chunkIndexOffset, chunkCount, err := chunker.addSource(sourceBytes)
+				if err != nil {
+					return nil, err
+				}
+				encoded = appendU32BE(encoded, chunkIndexOffset)
+				encoded = appendU32BE(encoded, chunkCount)
 			} else {
-				modulesHeader = appendU32BE(modulesHeader, 0)
-				modulesHeader = appendU32BE(modulesHeader, 0)
+				onDiskSource, err := compression.Compress(sourceBytes)
+				if err != nil {
+					return nil, err
+				}
+
+				if len(onDiskSource) > 0 {
+					offset, length := dedupedAppend(&sources, onDiskSource, sourceDedup, dedupeHash, checksum)
+					encoded = appendU32BE(encoded, offset)
+					encoded = appendU32BE(encoded, length)
+				} else {
+					encoded = appendU32BE(encoded, 0)
+					encoded = appendU32BE(encoded, 0)
+				}
 			}
 
 			// Get source map bytes
@@ -80,33 +125,42 @@ func (e *EszipV2) IntoBytes() ([]byte, error) {
 			if sourceMapBytes == nil && m.SourceMap.State() == SourceSlotReady {
 				sourceMapBytes = []byte{}
 			}
-			sourceMapLen := uint32(len(sourceMapBytes))
+			uncompressedSourceMapLen := uint32(len(sourceMapBytes))
 
-			if sourceMapLen > 0 {
-				sourceMapOffset := uint32(len(sourceMaps))
-				sourceMaps = append(sourceMaps, sourceMapBytes...)
-				sourceMaps = append(sourceMaps, checksum.Hash(sourceMapBytes)...)
+			onDiskSourceMap, err := compression.Compress(sourceMapBytes)
+			if err != nil {
+				return nil, err
+			}
 
-				modulesHeader = appendU32BE(modulesHeader, sourceMapOffset)
-				modulesHeader = appendU32BE(modulesHeader, sourceMapLen)
+			if len(onDiskSourceMap) > 0 {
+				offset, length := dedupedAppend(&sourceMaps, onDiskSourceMap, sourceMapDedup, dedupeHash, checksum)
+				encoded = appendU32BE(encoded, offset)
+				encoded = appendU32BE(encoded, length)
 			} else {
-				modulesHeader = appendU32BE(modulesHeader, 0)
-				modulesHeader = appendU32BE(modulesHeader, 0)
+				encoded = appendU32BE(encoded, 0)
+				encoded = appendU32BE(encoded, 0)
 			}
 
 			// Write module kind
-			modulesHeader = append(modulesHeader, byte(m.Kind))
+			encoded = append(encoded, byte(m.Kind))
+
+			// Write uncompressed lengths (VersionV2_4+); the offset/len
+			// pair above always describes the on-disk, compressed size.
+			encoded = appendU32BE(encoded, uncompressedSourceLen)
+			encoded = appendU32BE(encoded, uncompressedSourceMapLen)
 
 		case *ModuleRedirect:
 			// Write redirect entry
-			modulesHeader = append(modulesHeader, byte(HeaderFrameRedirect))
-			appendString(&modulesHeader, m.Target)
+			encoded = append(encoded, byte(HeaderFrameRedirect))
+			appendString(&encoded, m.Target)
 
 		case *NpmSpecifierEntry:
 			// Write npm specifier entry
-			modulesHeader = append(modulesHeader, byte(HeaderFrameNpmSpecifier))
-			modulesHeader = appendU32BE(modulesHeader, m.PackageID)
+			encoded = append(encoded, byte(HeaderFrameNpmSpecifier))
+			encoded = appendU32BE(encoded, m.PackageID)
 		}
+
+		entries = append(entries, indexHeaderEntry{specifier: specifier, encoded: encoded})
 	}
 
 	// Add npm snapshot entries if present
@@ -141,40 +195,63 @@ func (e *EszipV2) IntoBytes() ([]byte, error) {
 		})
 
 		for _, rp := range rootPkgs {
-			appendString(&modulesHeader, rp.req)
-			modulesHeader = append(modulesHeader, byte(HeaderFrameNpmSpecifier))
-			modulesHeader = appendU32BE(modulesHeader, idToIndex[rp.id])
+			encoded := []byte{byte(HeaderFrameNpmSpecifier)}
+			encoded = appendU32BE(encoded, idToIndex[rp.id])
+			entries = append(entries, indexHeaderEntry{specifier: rp.req, encoded: encoded})
 		}
 
 		// Write packages to npm bytes
 		for _, pkg := range packages {
 			appendString(&npmBytes, pkg.ID.String())
 
-			// Write dependencies count
-			npmBytes = appendU32BE(npmBytes, uint32(len(pkg.Dependencies)))
-
-			// Sort dependencies for determinism
-			deps := make([]struct {
-				req string
-				id  string
-			}, 0, len(pkg.Dependencies))
+			type npmDepEntry struct {
+				req  string
+				id   string
+				kind NpmDependencyKind
+			}
+			deps := make([]npmDepEntry, 0, len(pkg.Dependencies))
 			for req, id := range pkg.Dependencies {
-				deps = append(deps, struct {
-					req string
-					id  string
-				}{req: req, id: id.String()})
+				deps = append(deps, npmDepEntry{req: req, id: id.String(), kind: NpmDependencyRegular})
 			}
+			if npmDepKinds {
+				for req, id := range pkg.PeerDependencies {
+					deps = append(deps, npmDepEntry{req: req, id: id.String(), kind: NpmDependencyPeer})
+				}
+				for req, id := range pkg.OptionalDependencies {
+					deps = append(deps, npmDepEntry{req: req, id: id.String(), kind: NpmDependencyOptional})
+				}
+				for req, id := range pkg.OptionalPeerDependencies {
+					deps = append(deps, npmDepEntry{req: req, id: id.String(), kind: NpmDependencyPeerOptional})
+				}
+			}
+			// Sort dependencies for determinism
 			sort.Slice(deps, func(i, j int) bool {
-				return deps[i].req < deps[j].req
+				if deps[i].req != deps[j].req {
+					return deps[i].req < deps[j].req
+				}
+				return deps[i].kind < deps[j].kind
 			})
 
+			// Write dependencies count
+			npmBytes = appendU32BE(npmBytes, uint32(len(deps)))
+
 			for _, dep := range deps {
 				appendString(&npmBytes, dep.req)
+				if npmDepKinds {
+					npmBytes = append(npmBytes, byte(dep.kind))
+				}
 				npmBytes = appendU32BE(npmBytes, idToIndex[dep.id])
 			}
 		}
 	}
 
+	var modulesHeader []byte
+	if LatestVersion.SupportsSortedIndex() {
+		modulesHeader = encodeIndexedModulesHeader(entries)
+	} else {
+		modulesHeader = encodeLinearModulesHeader(entries)
+	}
+
 	// Write modules header length
 	modulesHeaderLenBytes := make([]byte, 4)
 	binary.BigEndian.PutUint32(modulesHeaderLenBytes, uint32(len(modulesHeader)))
@@ -194,6 +271,16 @@ func (e *EszipV2) IntoBytes() ([]byte, error) {
 	result = append(result, npmBytes...)
 	result = append(result, checksum.Hash(npmBytes)...)
 
+	// Write chunks section (only present when chunking is enabled)
+	if chunker != nil {
+		chunksSection := chunker.build()
+		chunksLenBytes := make([]byte, 4)
+		binary.BigEndian.PutUint32(chunksLenBytes, uint32(len(chunksSection)))
+		result = append(result, chunksLenBytes...)
+		result = append(result, chunksSection...)
+		result = append(result, checksum.Hash(chunksSection)...)
+	}
+
 	// Write sources section
 	sourcesLenBytes := make([]byte, 4)
 	binary.BigEndian.PutUint32(sourcesLenBytes, uint32(len(sources)))
@@ -209,6 +296,32 @@ func (e *EszipV2) IntoBytes() ([]byte, error) {
 	return result, nil
 }
 
+// dedupedAppend appends content to *section, returning its (offset, length)
+// within the section. When dedup is non-nil, content already seen (matched
+// by its dedupeHash digest) is not appended again -- the existing entry's
+// offset/length is returned instead, so multiple header entries end up
+// pointing at the same bytes.
+func dedupedAppend(section *[]byte, content []byte, dedup map[string][2]uint32, dedupeHash, checksum ChecksumType) (offset, length uint32) {
+	if dedup != nil {
+		key := string(dedupeHash.Hash(content))
+		if existing, ok := dedup[key]; ok {
+			return existing[0], existing[1]
+		}
+		offset = uint32(len(*section))
+		length = uint32(len(content))
+		*section = append(*section, content...)
+		*section = append(*section, checksum.Hash(content)...)
+		dedup[key] = [2]uint32{offset, length}
+		return offset, length
+	}
+
+	offset = uint32(len(*section))
+	length = uint32(len(content))
+	*section = append(*section, content...)
+	*section = append(*section, checksum.Hash(content)...)
+	return offset, length
+}
+
 func appendString(buf *[]byte, s string) {
 	lenBytes := make([]byte, 4)
 	binary.BigEndian.PutUint32(lenBytes, uint32(len(s)))